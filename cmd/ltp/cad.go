@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Neokil/ltp/internal/compare"
+	"github.com/Neokil/ltp/internal/export"
+	"github.com/Neokil/ltp/internal/mesh"
+)
+
+// cadResult is the verdict of a CAD comparison with the RMS distance left
+// after registering the scan to the model
+type cadResult struct {
+	compare.Result
+	RegistrationRMS float64 `json:"registration_rms"`
+}
+
+func runCAD(args []string) error {
+	fs := flag.NewFlagSet("cad", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	options := compare.NewOptions()
+	icpOptions := compare.NewICPOptions()
+	renderOptions := mesh.NewRenderOptions()
+	modelFile := ""
+	output := ""
+	imageOutput := ""
+	fs.StringVar(&modelFile, "model", "", "ASCII or binary STL of the part in mm, lying on the plate with Z pointing up. With -align the model is first moved so the center of its bounds lies on the center of the bounds of the scan")
+	fs.Float64Var(&renderOptions.Margin, "margin", renderOptions.Margin, "plate around the model in mm that is compared as well")
+	fs.Float64Var(&options.Lower, "lower", options.Lower, "lowest allowed deviation from the model in mm")
+	fs.Float64Var(&options.Upper, "upper", options.Upper, "highest allowed deviation from the model in mm")
+	fs.Float64Var(&options.MinFailArea, "min-fail-area", options.MinFailArea, "smaller areas outside the tolerance in mm² are ignored as noise")
+	fs.Float64Var(&options.MinCoverage, "min-coverage", options.MinCoverage, "percentage of the model the scan needs to cover")
+	fs.BoolVar(&options.Align, "align", options.Align, "register the scan to the model by translation and rotation")
+	fs.Float64Var(&options.MaxShift, "max-shift", options.MaxShift, "largest translation in mm searched by the coarse alignment")
+	fs.Float64Var(&options.MaxRotation, "max-rotation", options.MaxRotation, "largest rotation in degrees searched by the coarse alignment")
+	fs.IntVar(&icpOptions.Iterations, "icp-iterations", icpOptions.Iterations, "maximum number of ICP iterations refining the alignment")
+	fs.Float64Var(&icpOptions.MaxDistance, "icp-max-distance", icpOptions.MaxDistance, "points further apart in mm are not paired by ICP")
+	fs.BoolVar(&icpOptions.FitZ, "fit-z", icpOptions.FitZ, "also fit the height offset between scan and model")
+	fs.StringVar(&output, "o", "", "write the verdict as JSON to this file instead of stdout")
+	fs.StringVar(&imageOutput, "image", "", "write the deviation heatmap as PNG to this file")
+	fs.Parse(args)
+
+	if modelFile == "" {
+		return fmt.Errorf("no model given, use -model")
+	}
+	model, err := mesh.LoadSTL(modelFile)
+	if err != nil {
+		return err
+	}
+
+	frames, hmOptions, err := sf.scan(fs.Args())
+	if err != nil {
+		return err
+	}
+	hm, err := sf.heightMap(frames, hmOptions)
+	if err != nil {
+		return err
+	}
+
+	// the model is rendered with the resolution of the scan
+	renderOptions.SpacingX = hmOptions.FeedPerFrame
+	renderOptions.SpacingY = hmOptions.RowSpacing
+	reference, err := model.RenderHeightMap(renderOptions)
+	if err != nil {
+		return fmt.Errorf("failed to render model: %w", err)
+	}
+
+	minX, minY, maxX, maxY := reference.Bounds()
+	alignment := compare.Alignment{CenterX: (minX + maxX) / 2, CenterY: (minY + maxY) / 2}
+	rms := 0.0
+	if options.Align {
+		// the model has its own coordinates, so the search starts with the
+		// centers on top of each other
+		alignment, rms, err = compare.Register(reference, hm, compare.CenterAlignment(reference, hm), options, icpOptions)
+		if err != nil {
+			return fmt.Errorf("failed to register scan: %w", err)
+		}
+	}
+	result, err := compare.CompareAligned(reference, hm, alignment, options)
+	if err != nil {
+		return fmt.Errorf("failed to compare: %w", err)
+	}
+
+	if imageOutput != "" {
+		if err := writeFile(imageOutput, func(w io.Writer) error {
+			return export.WriteDeviationPNG(w, result.Deviation, options.Lower, options.Upper)
+		}); err != nil {
+			return err
+		}
+	}
+
+	writeJSON := func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(cadResult{Result: result, RegistrationRMS: rms})
+	}
+	if output != "" {
+		err = writeFile(output, writeJSON)
+	} else {
+		err = writeJSON(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+	if !result.Pass {
+		return fmt.Errorf("the part failed the comparison")
+	}
+
+	return nil
+}
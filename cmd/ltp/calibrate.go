@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+)
+
+func runCalibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	plateFile := ""
+	blockFile := ""
+	blockHeight := 0.0
+	lines := 1
+	output := ""
+	fs.StringVar(&plateFile, "plate", "", "image of the laser line on the empty plate")
+	fs.StringVar(&blockFile, "block", "", "image of the laser line on a gauge block")
+	fs.Float64Var(&blockHeight, "block-height", blockHeight, "height of the gauge block in mm")
+	fs.IntVar(&lines, "lines", lines, "number of parallel lines of a projector to calibrate together for the multi-line mode")
+	fs.StringVar(&output, "o", "", "write the line calibration to this file")
+	fs.Parse(args)
+
+	if plateFile == "" || blockFile == "" || output == "" {
+		return fmt.Errorf("-plate, -block and -o are required")
+	}
+	if err := sf.lasers(); err != nil {
+		return err
+	}
+	if len(sf.processor.Lasers) > 0 {
+		return fmt.Errorf("calibrate one laser color at a time")
+	}
+	sf.processor.Detection = frameprocessor.Detection(sf.detection)
+
+	plate, err := readImage(plateFile)
+	if err != nil {
+		return err
+	}
+	block, err := readImage(blockFile)
+	if err != nil {
+		return err
+	}
+	calibration, err := frameprocessor.CalibrateLines(plate, block, blockHeight, lines, sf.processor)
+	if err != nil {
+		return fmt.Errorf("failed to calibrate: %w", err)
+	}
+
+	// a single line is written on its own to keep the files of the single-line mode
+	return writeFile(output, func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		if lines == 1 {
+			return e.Encode(calibration[0])
+		}
+		return e.Encode(calibration)
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Neokil/ltp/internal/compare"
+	"github.com/Neokil/ltp/internal/export"
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	options := compare.NewOptions()
+	referenceFile := ""
+	output := ""
+	imageOutput := ""
+	fs.StringVar(&referenceFile, "reference", "", "height map of the known-good part, written by \"ltp export -format heightmap\"")
+	fs.Float64Var(&options.Lower, "lower", options.Lower, "lowest allowed deviation from the reference in mm")
+	fs.Float64Var(&options.Upper, "upper", options.Upper, "highest allowed deviation from the reference in mm")
+	fs.Float64Var(&options.MinFailArea, "min-fail-area", options.MinFailArea, "smaller areas outside the tolerance in mm² are ignored as noise")
+	fs.Float64Var(&options.MinCoverage, "min-coverage", options.MinCoverage, "percentage of the reference the scan needs to cover")
+	fs.BoolVar(&options.Align, "align", options.Align, "align the scan to the reference by translation and rotation")
+	fs.Float64Var(&options.MaxShift, "max-shift", options.MaxShift, "largest translation in mm searched by the alignment")
+	fs.Float64Var(&options.MaxRotation, "max-rotation", options.MaxRotation, "largest rotation in degrees searched by the alignment")
+	fs.StringVar(&output, "o", "", "write the verdict as JSON to this file instead of stdout")
+	fs.StringVar(&imageOutput, "image", "", "write the deviation heatmap as PNG to this file")
+	fs.Parse(args)
+
+	if referenceFile == "" {
+		return fmt.Errorf("no reference given, use -reference")
+	}
+	reference, err := heightmap.Load(referenceFile)
+	if err != nil {
+		return err
+	}
+
+	frames, hmOptions, err := sf.scan(fs.Args())
+	if err != nil {
+		return err
+	}
+	hm, err := sf.heightMap(frames, hmOptions)
+	if err != nil {
+		return err
+	}
+	result, err := compare.Compare(reference, hm, options)
+	if err != nil {
+		return fmt.Errorf("failed to compare: %w", err)
+	}
+
+	if imageOutput != "" {
+		if err := writeFile(imageOutput, func(w io.Writer) error {
+			return export.WriteDeviationPNG(w, result.Deviation, options.Lower, options.Upper)
+		}); err != nil {
+			return err
+		}
+	}
+
+	writeJSON := func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(result)
+	}
+	if output != "" {
+		err = writeFile(output, writeJSON)
+	} else {
+		err = writeJSON(os.Stdout)
+	}
+	if err != nil {
+		return err
+	}
+	if !result.Pass {
+		return fmt.Errorf("the part failed the comparison")
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Neokil/ltp/internal/export"
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/mesh"
+	"github.com/Neokil/ltp/internal/pointcloud"
+	"github.com/Neokil/ltp/internal/resample"
+)
+
+type exporter struct {
+	description string
+	write       func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error
+}
+
+type exportFlags struct {
+	output          string
+	format          string
+	mesh            mesh.Options
+	color           bool
+	probe           export.ProbeGridOptions
+	probeGCode      export.ProbeGCodeOptions
+	resample        resample.Options
+	resampleSpacing float64
+	resampleMethod  string
+}
+
+var exporters = map[string]exporter{
+	"csv": {
+		description: "profile data per frame and row",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			return export.WriteProfilesCSV(w, frames)
+		},
+	},
+	"xyz": {
+		description: "x y z point list",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			return export.WriteXYZ(w, pointcloud.FromHeightMap(hm))
+		},
+	},
+	"npy": {
+		description: "float32 height grid, the mask of valid cells is written to <output>.mask.npy",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			if err := export.WriteNPY(w, hm); err != nil {
+				return err
+			}
+
+			return writeFile(strings.TrimSuffix(ef.output, ".npy")+".mask.npy", func(w io.Writer) error {
+				return export.WriteNPYMask(w, hm)
+			})
+		},
+	},
+	"ply": {
+		description: "binary point cloud",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			options := export.NewPLYOptions()
+			options.Color = ef.color
+
+			return export.WritePLY(w, pointcloud.FromHeightMap(hm), options)
+		},
+	},
+	"ply-ascii": {
+		description: "ascii point cloud",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			options := export.NewPLYOptions()
+			options.Format = export.PLYASCII
+			options.Color = ef.color
+
+			return export.WritePLY(w, pointcloud.FromHeightMap(hm), options)
+		},
+	},
+	"stl": {
+		description: "binary mesh",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			m, err := mesh.FromHeightMap(hm, ef.mesh)
+			if err != nil {
+				return err
+			}
+
+			return export.WriteSTL(w, m, export.STLBinary)
+		},
+	},
+	"stl-ascii": {
+		description: "ascii mesh",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			m, err := mesh.FromHeightMap(hm, ef.mesh)
+			if err != nil {
+				return err
+			}
+
+			return export.WriteSTL(w, m, export.STLASCII)
+		},
+	},
+	"obj": {
+		description: "mesh with vertex normals",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			m, err := mesh.FromHeightMap(hm, ef.mesh)
+			if err != nil {
+				return err
+			}
+
+			return export.WriteOBJ(w, m)
+		},
+	},
+	"png16": {
+		description: "16-bit grayscale height map",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			return export.WritePNG16(w, hm, export.NewHeightEncoding(hm))
+		},
+	},
+	"tiff": {
+		description: "16-bit grayscale height map",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			return export.WriteTIFF16(w, hm, export.NewHeightEncoding(hm))
+		},
+	},
+	"autolevel-gcode": {
+		description: "G38.2 probe program with the scanned heights as probe results",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			grid, err := export.ResampleProbeGrid(hm, ef.probe)
+			if err != nil {
+				return err
+			}
+
+			return export.WriteProbeGCode(w, grid, ef.probeGCode)
+		},
+	},
+	"autolevel-grid": {
+		description: "probe grid with origin and spacing",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			grid, err := export.ResampleProbeGrid(hm, ef.probe)
+			if err != nil {
+				return err
+			}
+
+			return export.WriteProbeGrid(w, grid)
+		},
+	},
+	"falsecolor": {
+		description: "8-bit false-color height map with legend",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			return export.WriteFalseColorPNG(w, hm)
+		},
+	},
+	"heightmap": {
+		description: "JSON height map that can be used as reference for compare",
+		write: func(w io.Writer, ef *exportFlags, frames []pointcloud.Frame, hm *heightmap.HeightMap) error {
+			return hm.Write(w)
+		},
+	},
+}
+
+func exportFormats() string {
+	formats := []string{}
+	for _, name := range []string{"csv", "xyz", "npy", "ply", "ply-ascii", "stl", "stl-ascii", "obj", "png16", "tiff", "falsecolor", "autolevel-gcode", "autolevel-grid", "heightmap"} {
+		formats = append(formats, fmt.Sprintf("%s (%s)", name, exporters[name].description))
+	}
+
+	return strings.Join(formats, ", ")
+}
+
+func registerExportFlags(fs *flag.FlagSet, format string) *exportFlags {
+	ef := &exportFlags{mesh: mesh.NewOptions(), probe: export.NewProbeGridOptions(), probeGCode: export.NewProbeGCodeOptions(), resample: resample.NewOptions()}
+	fs.StringVar(&ef.output, "o", "", "output file")
+	fs.StringVar(&ef.format, "format", format, "output format, one of: "+exportFormats())
+	fs.BoolVar(&ef.mesh.Solid, "solid", ef.mesh.Solid, "add a base and side walls to meshes")
+	fs.Float64Var(&ef.mesh.BaseHeight, "base-height", ef.mesh.BaseHeight, "height of the mesh base in mm")
+	fs.Float64Var(&ef.probe.SpacingX, "probe-spacing-x", ef.probe.SpacingX, "X distance between two autolevel probe points in mm")
+	fs.Float64Var(&ef.probe.SpacingY, "probe-spacing-y", ef.probe.SpacingY, "Y distance between two autolevel probe points in mm")
+	fs.Float64Var(&ef.probe.OriginX, "probe-origin-x", ef.probe.OriginX, "X position of the first autolevel probe point in mm, only used with -probe-count-x")
+	fs.Float64Var(&ef.probe.OriginY, "probe-origin-y", ef.probe.OriginY, "Y position of the first autolevel probe point in mm, only used with -probe-count-y")
+	fs.IntVar(&ef.probe.CountX, "probe-count-x", ef.probe.CountX, "number of autolevel probe points along X, 0 covers the whole scan starting at its edge")
+	fs.IntVar(&ef.probe.CountY, "probe-count-y", ef.probe.CountY, "number of autolevel probe points along Y, 0 covers the whole scan starting at its edge")
+	fs.Float64Var(&ef.probeGCode.OffsetX, "probe-offset-x", ef.probeGCode.OffsetX, "added to the X coordinates of the autolevel G-code to convert scan into machine coordinates")
+	fs.Float64Var(&ef.probeGCode.OffsetY, "probe-offset-y", ef.probeGCode.OffsetY, "added to the Y coordinates of the autolevel G-code to convert scan into machine coordinates")
+	fs.Float64Var(&ef.probeGCode.OffsetZ, "probe-offset-z", ef.probeGCode.OffsetZ, "added to the scanned heights in the autolevel G-code")
+	fs.Float64Var(&ef.resampleSpacing, "resample", 0, "resample the height map onto a uniform grid with this spacing in mm before exporting, 0 to disable")
+	fs.StringVar(&ef.resampleMethod, "resample-method", string(ef.resample.Method), fmt.Sprintf("interpolation of -resample, %s, %s or %s", resample.Nearest, resample.Bilinear, resample.InverseDistance))
+	fs.Float64Var(&ef.resample.MaxRadius, "resample-max-radius", ef.resample.MaxRadius, "grid points of -resample without a cell within this distance in mm stay empty")
+
+	return ef
+}
+
+// resamples the height map if -resample is set
+func (ef *exportFlags) heightMap(hm *heightmap.HeightMap) (*heightmap.HeightMap, error) {
+	if ef.resampleSpacing == 0 {
+		return hm, nil
+	}
+	ef.resample.SpacingX = ef.resampleSpacing
+	ef.resample.SpacingY = ef.resampleSpacing
+	ef.resample.Method = resample.Method(ef.resampleMethod)
+	resampled, err := resample.HeightMap(hm, ef.resample)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resample height map: %w", err)
+	}
+
+	return resampled, nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	ef := registerExportFlags(fs, "csv")
+	fs.BoolVar(&ef.color, "color", false, "sample point colors from the frames (ply only)")
+	colorOffset := heightmap.NewOptions().ColorOffset
+	fs.IntVar(&colorOffset, "color-offset", colorOffset, "distance in pixel from the laser line at which -color samples the part, more than half the width of the line")
+	fs.Parse(args)
+
+	exp, ok := exporters[ef.format]
+	if !ok {
+		return fmt.Errorf("format \"%s\" is invalid. Valid formats are: %s", ef.format, exportFormats())
+	}
+	if ef.output == "" {
+		return fmt.Errorf("no output file given, use -o")
+	}
+
+	sf.keepImages = ef.color
+	frames, options, err := sf.scan(fs.Args())
+	if err != nil {
+		return err
+	}
+	options.ColorOffset = colorOffset
+	hm, err := sf.heightMap(frames, options)
+	if err != nil {
+		return err
+	}
+	hm, err = ef.heightMap(hm)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(ef.output, func(w io.Writer) error {
+		return exp.write(w, ef, frames, hm)
+	})
+}
+
+func writeFile(filename string, write func(w io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filename, err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+
+	return f.Close()
+}
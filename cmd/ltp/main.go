@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{name: "calibrate", description: "calibrate the baseline and shift of a laser line with a gauge block", run: runCalibrate},
+	{name: "export", description: "scan the input and export profiles, point clouds, meshes or height maps", run: runExport},
+	{name: "measure", description: "scan the input and measure volume, area and height of the material on the plate", run: runMeasure},
+	{name: "segment", description: "scan the input and report every object on the plate on its own", run: runSegment},
+	{name: "profile", description: "scan the input and run step, groove, gap, angle and fit measurements on the profiles", run: runProfile},
+	{name: "surface", description: "scan the input and report roughness, areal parameters and flatness", run: runSurface},
+	{name: "compare", description: "scan the input and compare it to a reference height map with tolerances", run: runCompare},
+	{name: "cad", description: "scan the input and compare it to an STL model with tolerances", run: runCAD},
+	{name: "stitch", description: "scan several parallel passes and stitch them into one height map", run: runStitch},
+	{name: "rotary", description: "scan a part on a rotary table and export a closed 360° point cloud or mesh", run: runRotary},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: ltp <command> [options] <video | images...>\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"ltp <command> -h\" for the options of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "ltp %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	usage()
+	os.Exit(2)
+}
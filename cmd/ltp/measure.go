@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Neokil/ltp/internal/measure"
+)
+
+func runMeasure(args []string) error {
+	fs := flag.NewFlagSet("measure", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	options := measure.NewOptions()
+	output := ""
+	fs.Float64Var(&options.Threshold, "threshold", options.Threshold, "heights above this value in mm count as material")
+	fs.Func("region", "region to measure on its own as name:minX,minY,maxX,maxY in mm, can be repeated", func(s string) error {
+		r, err := measure.ParseRegion(s)
+		if err != nil {
+			return err
+		}
+		options.Regions = append(options.Regions, r)
+		return nil
+	})
+	fs.BoolVar(&options.IncludeInterpolated, "include-interpolated", options.IncludeInterpolated, "measure the cells filled by -fill-holes too")
+	fs.StringVar(&output, "o", "", "write the report as JSON to this file instead of printing it")
+	fs.Parse(args)
+
+	frames, hmOptions, err := sf.scan(fs.Args())
+	if err != nil {
+		return err
+	}
+	hm, err := sf.heightMap(frames, hmOptions)
+	if err != nil {
+		return err
+	}
+	report, err := measure.Measure(hm, options)
+	if err != nil {
+		return fmt.Errorf("failed to measure: %w", err)
+	}
+
+	if output != "" {
+		return writeFile(output, func(w io.Writer) error {
+			e := json.NewEncoder(w)
+			e.SetIndent("", "  ")
+			return e.Encode(report)
+		})
+	}
+
+	printReport(os.Stdout, report)
+
+	return nil
+}
+
+func printReport(w io.Writer, report measure.Report) {
+	u := report.Units
+	fmt.Fprintf(w, "material above %g %s\n", report.Threshold, u.Length)
+	for _, r := range append([]measure.Result{report.Total}, report.Regions...) {
+		fmt.Fprintf(w, "\n%s:\n", r.Name)
+		if r.Cells == 0 {
+			fmt.Fprintf(w, "  no material\n")
+			continue
+		}
+		fmt.Fprintf(w, "  volume:       %.4f %s\n", r.Volume, u.Volume)
+		fmt.Fprintf(w, "  area:         %.4f %s\n", r.Area, u.Area)
+		fmt.Fprintf(w, "  max height:   %.4f %s\n", r.MaxHeight, u.Length)
+		fmt.Fprintf(w, "  mean height:  %.4f %s\n", r.MeanHeight, u.Length)
+		b := r.BoundingBox
+		fmt.Fprintf(w, "  bounding box: x %.4f..%.4f, y %.4f..%.4f, z %.4f..%.4f %s\n", b.MinX, b.MaxX, b.MinY, b.MaxY, b.MinZ, b.MaxZ, u.Length)
+	}
+}
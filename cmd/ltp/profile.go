@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Neokil/ltp/internal/section"
+)
+
+// frameResults are the measurements on the profile of one height map frame
+type frameResults struct {
+	Frame    int              `json:"frame"` // height map frame, not the index of the camera frame
+	Position float64          `json:"position"`
+	Results  []section.Result `json:"results"`
+}
+
+func runProfile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	definitionsFile := ""
+	frame := -1
+	output := ""
+	fs.StringVar(&definitionsFile, "definitions", "", "JSON file with the list of measurements, each with name, type (step, groove, gap, angle, line, circle), ranges a and b as [from, to] in mm, and level or tolerance")
+	fs.IntVar(&frame, "frame", frame, "only measure the profile of this height map frame, -1 measures every frame; in the multi-line mode every camera frame gives one height map frame per line")
+	fs.StringVar(&output, "o", "", "write the results as JSON to this file instead of stdout")
+	fs.Parse(args)
+
+	if definitionsFile == "" {
+		return fmt.Errorf("no measurement definitions given, use -definitions")
+	}
+	definitions, err := section.LoadDefinitions(definitionsFile)
+	if err != nil {
+		return err
+	}
+
+	frames, options, err := sf.scan(fs.Args())
+	if err != nil {
+		return err
+	}
+	hm, err := sf.heightMap(frames, options)
+	if err != nil {
+		return err
+	}
+	if frame >= hm.Frames() {
+		return fmt.Errorf("frame %d does not exist, the height map has %d frames", frame, hm.Frames())
+	}
+
+	results := []frameResults{}
+	for f := range hm.Frames() {
+		if frame >= 0 && f != frame {
+			continue
+		}
+		p := section.FromHeightMap(hm, f)
+		fr := frameResults{Frame: f, Position: hm.FrameToMM(f)}
+		for _, d := range definitions {
+			fr.Results = append(fr.Results, d.Measure(p))
+		}
+		results = append(results, fr)
+	}
+
+	writeJSON := func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(results)
+	}
+	if output != "" {
+		return writeFile(output, writeJSON)
+	}
+
+	return writeJSON(os.Stdout)
+}
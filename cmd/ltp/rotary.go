@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Neokil/ltp/internal/export"
+	"github.com/Neokil/ltp/internal/frameprocessor"
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/rotary"
+)
+
+var rotaryWriters = map[string]func(w io.Writer, hm *heightmap.HeightMap, options rotary.Options) error{
+	"xyz": func(w io.Writer, hm *heightmap.HeightMap, options rotary.Options) error {
+		pc, err := rotary.PointCloud(hm, options)
+		if err != nil {
+			return err
+		}
+
+		return export.WriteXYZ(w, pc)
+	},
+	"ply": func(w io.Writer, hm *heightmap.HeightMap, options rotary.Options) error {
+		pc, err := rotary.PointCloud(hm, options)
+		if err != nil {
+			return err
+		}
+
+		return export.WritePLY(w, pc, export.NewPLYOptions())
+	},
+	"ply-ascii": func(w io.Writer, hm *heightmap.HeightMap, options rotary.Options) error {
+		pc, err := rotary.PointCloud(hm, options)
+		if err != nil {
+			return err
+		}
+		plyOptions := export.NewPLYOptions()
+		plyOptions.Format = export.PLYASCII
+
+		return export.WritePLY(w, pc, plyOptions)
+	},
+	"stl": func(w io.Writer, hm *heightmap.HeightMap, options rotary.Options) error {
+		m, err := rotary.Mesh(hm, options)
+		if err != nil {
+			return err
+		}
+
+		return export.WriteSTL(w, m, export.STLBinary)
+	},
+	"stl-ascii": func(w io.Writer, hm *heightmap.HeightMap, options rotary.Options) error {
+		m, err := rotary.Mesh(hm, options)
+		if err != nil {
+			return err
+		}
+
+		return export.WriteSTL(w, m, export.STLASCII)
+	},
+	"obj": func(w io.Writer, hm *heightmap.HeightMap, options rotary.Options) error {
+		m, err := rotary.Mesh(hm, options)
+		if err != nil {
+			return err
+		}
+
+		return export.WriteOBJ(w, m)
+	},
+}
+
+func runRotary(args []string) error {
+	fs := flag.NewFlagSet("rotary", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	options := rotary.NewOptions()
+	degreesPerFrame := 1.0
+	output := ""
+	format := "ply"
+	formats := []string{}
+	for name := range rotaryWriters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	fs.Float64Var(&degreesPerFrame, "degrees-per-frame", degreesPerFrame, "angle the table turns between two frames, replaces -feed; with -motion-log the positions are angles in degrees")
+	fs.Float64Var(&options.AxisOffset, "axis-offset", options.AxisOffset, "distance from the rotation axis to height 0 in mm")
+	fs.Float64Var(&options.MaxGap, "max-gap", options.MaxGap, "largest missing angle in degrees for the turn to be closed")
+	fs.StringVar(&output, "o", "", "output file")
+	fs.StringVar(&format, "format", format, "output format, one of: "+strings.Join(formats, ", "))
+	fs.Parse(args)
+
+	write, ok := rotaryWriters[format]
+	if !ok {
+		return fmt.Errorf("format \"%s\" is invalid. Valid formats are: %s", format, strings.Join(formats, ", "))
+	}
+	if output == "" {
+		return fmt.Errorf("no output file given, use -o")
+	}
+
+	if sf.mode == string(frameprocessor.ModeMultiLine) {
+		return fmt.Errorf("the %s mode is not supported on a rotary table", frameprocessor.ModeMultiLine)
+	}
+	sf.feed = degreesPerFrame
+	frames, hmOptions, err := sf.scan(fs.Args())
+	if err != nil {
+		return err
+	}
+	hm, err := sf.heightMap(frames, hmOptions)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(output, func(w io.Writer) error {
+		return write(w, hm, options)
+	})
+}
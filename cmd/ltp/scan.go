@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/motion"
+	"github.com/Neokil/ltp/internal/pointcloud"
+	"github.com/Neokil/ltp/internal/videoreader"
+)
+
+var videoExtensions = []string{".mp4", ".avi", ".mov", ".mkv", ".webm"}
+
+// scanFlags are the options shared by all commands that scan an input
+type scanFlags struct {
+	processor       frameprocessor.ProcessorOptions
+	laserColor      string
+	maxDeviations   []uint16
+	estimateColor   int
+	mahalanobis     bool
+	mode            string
+	detection       string
+	lineCalibration string
+	feed            float64
+	motionLog       string
+	keepImages      bool
+	level           bool
+	levelOptions    heightmap.LevelOptions
+	medianSize      int
+	medianDeviation float64
+	outlierSize     int
+	outlierStdDevs  float64
+	fillHoles       int
+}
+
+func registerScanFlags(fs *flag.FlagSet) *scanFlags {
+	sf := &scanFlags{processor: frameprocessor.NewProcessorOptions(), levelOptions: heightmap.NewLevelOptions()}
+	sf.processor.CalibrationResults.PixelPerMM = 1
+
+	fs.StringVar(&sf.laserColor, "laser-color", "#ff0000", "color of the laser as hex value, two comma separated colors tell the lines of the dual-line mode apart by their color")
+	fs.Func("max-color-deviation", fmt.Sprintf("maximum distance to the laser color, comma separated per laser color (default %d)", sf.processor.MaxColorDeviation), func(s string) error {
+		sf.maxDeviations = nil
+		for _, value := range strings.Split(s, ",") {
+			deviation := uint16(0)
+			if _, err := fmt.Sscan(value, &deviation); err != nil {
+				return err
+			}
+			sf.maxDeviations = append(sf.maxDeviations, deviation)
+		}
+		return nil
+	})
+	fs.IntVar(&sf.estimateColor, "estimate-color", 0, "estimate the laser color from this many frames of the input instead of using -laser-color")
+	fs.BoolVar(&sf.mahalanobis, "mahalanobis", false, "compare the pixels to the colors of the estimated laser with the Mahalanobis distance, -max-color-deviation is then 1000 per standard deviation")
+	fs.StringVar(&sf.detection, "detection", string(frameprocessor.DetectionColor), fmt.Sprintf("how the laser is found, %s (by -laser-color) or %s (the brightest pixels of monochrome or IR frames)", frameprocessor.DetectionColor, frameprocessor.DetectionIntensity))
+	fs.Func("min-intensity", fmt.Sprintf("intensity detection: darker pixels are ignored, 16 bit gray, multiply 8 bit values by 257 (default %d)", sf.processor.MinIntensity), func(s string) error {
+		_, err := fmt.Sscan(s, &sf.processor.MinIntensity)
+		return err
+	})
+	fs.Func("min-peak-height", fmt.Sprintf("intensity detection: how much brighter a peak has to be than the pixels next to it, 16 bit gray (default %d)", sf.processor.MinPeakHeight), func(s string) error {
+		_, err := fmt.Sscan(s, &sf.processor.MinPeakHeight)
+		return err
+	})
+	fs.IntVar(&sf.processor.MinThroughWidth, "min-through-width", sf.processor.MinThroughWidth, "minimum width of a through in pixel, needs to be uneven")
+	fs.Func("min-through-height", fmt.Sprintf("minimum height of a through (default %d)", sf.processor.MinThroughHeight), func(s string) error {
+		_, err := fmt.Sscan(s, &sf.processor.MinThroughHeight)
+		return err
+	})
+	fs.StringVar(&sf.mode, "mode", string(sf.processor.Mode), fmt.Sprintf("how heights are calculated, %s (two lines meeting at the plate), %s (one line against a calibrated baseline) or %s (a profile per line of a projector)", frameprocessor.ModeDualLine, frameprocessor.ModeSingleLine, frameprocessor.ModeMultiLine))
+	fs.StringVar(&sf.lineCalibration, "line-calibration", "", "comma separated line calibrations written by \"ltp calibrate\", one for the single-line mode, one per laser for the dual-line mode to measure rows where a line is hidden or all lines of the projector for the multi-line mode")
+	fs.Float64Var(&sf.processor.MaxLineShift, "max-line-shift", sf.processor.MaxLineShift, "pixels a line of the multi-line mode may move between two rows to still be tracked")
+	fs.Float64Var(&sf.processor.CalibrationResults.PixelPerMM, "pixel-per-mm", sf.processor.CalibrationResults.PixelPerMM, "how many pixels represent one mm")
+	fs.Float64Var(&sf.processor.CalibrationResults.LateralOrigin, "lateral-origin", sf.processor.CalibrationResults.LateralOrigin, "column in pixel where the lateral position is 0, negative for the center of the frame")
+	fs.Float64Var(&sf.feed, "feed", 1, "distance the object moves between two frames in mm")
+	fs.StringVar(&sf.motionLog, "motion-log", "", "csv or json log of (timestamp, position) samples, replaces -feed for videos")
+	fs.BoolVar(&sf.level, "level", false, "fit a plane to the ground and subtract it to correct a tilted plate")
+	fs.Float64Var(&sf.levelOptions.MaxGroundHeight, "level-max-ground-height", sf.levelOptions.MaxGroundHeight, "height in mm up to which cells are candidates for the plate when leveling")
+	fs.IntVar(&sf.medianSize, "median-filter", 0, "remove cells that deviate from the median of a window of this many cells per side, uneven, 0 to disable")
+	fs.Float64Var(&sf.medianDeviation, "median-max-deviation", 0.5, "largest deviation from the median in mm for -median-filter")
+	fs.IntVar(&sf.outlierSize, "outlier-filter", 0, "remove cells that deviate from the mean of a window of this many cells per side by more than -outlier-std-devs, uneven, 0 to disable")
+	fs.Float64Var(&sf.outlierStdDevs, "outlier-std-devs", 3, "largest deviation from the mean in standard deviations for -outlier-filter")
+	fs.IntVar(&sf.fillHoles, "fill-holes", 0, "fill enclosed holes of up to this many cells, the filled cells are excluded from measurements, 0 to disable")
+
+	return sf
+}
+
+// loadLineCalibration reads a file written by "ltp calibrate", which holds a
+// single line or a list of lines
+func loadLineCalibration(filename string) ([]frameprocessor.LineCalibration, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open line calibration: %w", err)
+	}
+	lines := []frameprocessor.LineCalibration{}
+	if err := json.Unmarshal(data, &lines); err == nil {
+		return lines, nil
+	}
+	line := frameprocessor.LineCalibration{}
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, fmt.Errorf("failed to read line calibration: %w", err)
+	}
+
+	return []frameprocessor.LineCalibration{line}, nil
+}
+
+// lasers sets the laser colors and their deviations of the processor options.
+// A single color replaces the Lasercolor, several colors are set as Lasers.
+func (sf *scanFlags) lasers() error {
+	colors := strings.Split(sf.laserColor, ",")
+	if len(sf.maxDeviations) > 1 && len(sf.maxDeviations) != len(colors) {
+		return fmt.Errorf("got %d color deviations for %d laser colors", len(sf.maxDeviations), len(colors))
+	}
+
+	sf.processor.Lasers = nil
+	for i, s := range colors {
+		c, err := parseHexColor(s)
+		if err != nil {
+			return err
+		}
+		laser := frameprocessor.Laser{Color: c, MaxColorDeviation: sf.processor.MaxColorDeviation}
+		if len(sf.maxDeviations) > 0 {
+			laser.MaxColorDeviation = sf.maxDeviations[min(i, len(sf.maxDeviations)-1)]
+		}
+		sf.processor.Lasers = append(sf.processor.Lasers, laser)
+	}
+	if len(colors) == 1 {
+		sf.processor.Lasercolor = sf.processor.Lasers[0].Color
+		sf.processor.MaxColorDeviation = sf.processor.Lasers[0].MaxColorDeviation
+		sf.processor.Lasers = nil
+	}
+
+	return nil
+}
+
+// estimateLaserColor replaces the laser color by the one estimated from the
+// first frames of the inputs if requested
+func (sf *scanFlags) estimateLaserColor(inputs []string) error {
+	if sf.estimateColor <= 0 {
+		if sf.mahalanobis {
+			return fmt.Errorf("-mahalanobis needs the color estimated with -estimate-color")
+		}
+		return nil
+	}
+	if len(sf.processor.Lasers) > 0 {
+		return fmt.Errorf("the color can only be estimated for a single laser")
+	}
+
+	frames := []image.Image{}
+	if len(inputs) == 1 && isVideo(inputs[0]) {
+		handle, err := videoreader.New().Read(inputs[0])
+		if err != nil {
+			return err
+		}
+		for len(frames) < sf.estimateColor {
+			img, err := handle.GetNextImage()
+			if err == videoreader.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read frame: %w", err)
+			}
+			frames = append(frames, img)
+		}
+	} else {
+		for _, input := range inputs[:min(sf.estimateColor, len(inputs))] {
+			img, err := readImage(input)
+			if err != nil {
+				return err
+			}
+			frames = append(frames, img)
+		}
+	}
+
+	model, err := frameprocessor.EstimateColorModel(frames, frameprocessor.NewEstimateOptions())
+	if err != nil {
+		return fmt.Errorf("failed to estimate the laser color: %w", err)
+	}
+	c := model.Color()
+	sf.processor.Lasercolor = c
+	if sf.mahalanobis {
+		sf.processor.ColorModel = &model
+	}
+	fmt.Fprintf(os.Stderr, "estimated laser color: #%02x%02x%02x\n", c.R, c.G, c.B)
+
+	return nil
+}
+
+func parseHexColor(s string) (color.RGBA, error) {
+	c := color.RGBA{A: 255}
+	if _, err := fmt.Sscanf(strings.TrimPrefix(s, "#"), "%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return c, fmt.Errorf("invalid color \"%s\", expected a hex value like #ff0000: %w", s, err)
+	}
+
+	return c, nil
+}
+
+// scan determines the profile of every frame of the inputs. The inputs are
+// either a single video or a list of images that are used as frames.
+func (sf *scanFlags) scan(inputs []string) ([]pointcloud.Frame, heightmap.Options, error) {
+	options := heightmap.NewOptions()
+	if len(inputs) == 0 {
+		return nil, options, fmt.Errorf("no input given")
+	}
+
+	if err := sf.lasers(); err != nil {
+		return nil, options, err
+	}
+	if err := sf.estimateLaserColor(inputs); err != nil {
+		return nil, options, err
+	}
+	sf.processor.Mode = frameprocessor.Mode(sf.mode)
+	sf.processor.Detection = frameprocessor.Detection(sf.detection)
+	if sf.lineCalibration != "" {
+		for _, filename := range strings.Split(sf.lineCalibration, ",") {
+			lines, err := loadLineCalibration(filename)
+			if err != nil {
+				return nil, options, err
+			}
+			sf.processor.CalibrationResults.Lines = append(sf.processor.CalibrationResults.Lines, lines...)
+		}
+	}
+	if err := sf.processor.Validate(); err != nil {
+		return nil, options, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	options.FeedPerFrame = sf.feed
+	options.RowSpacing = 1 / sf.processor.CalibrationResults.PixelPerMM
+
+	// in the multi-line mode every line adds a profile at its own position
+	frames := []pointcloud.Frame{}
+	images := 0
+	unresolved := 0
+	addFrame := func(img image.Image, position float64) error {
+		profiles, err := frameprocessor.DetermineLineProfiles(img, sf.processor)
+		if err != nil {
+			return fmt.Errorf("failed to process frame %d: %w", images, err)
+		}
+		for _, profile := range profiles {
+			frame := pointcloud.Frame{Profile: profile, Index: images, Position: position + profile.Offset}
+			if sf.keepImages {
+				frame.Image = img
+			}
+			frames = append(frames, frame)
+		}
+		images++
+		for _, row := range profiles[0].Rows {
+			if row.Status == frameprocessor.StatusUnresolved {
+				unresolved++
+			}
+		}
+		options.Rows = max(options.Rows, img.Bounds().Dy())
+
+		return nil
+	}
+
+	if len(inputs) == 1 && isVideo(inputs[0]) {
+		if err := sf.scanVideo(inputs[0], addFrame); err != nil {
+			return nil, options, err
+		}
+	} else {
+		for i, input := range inputs {
+			img, err := readImage(input)
+			if err != nil {
+				return nil, options, err
+			}
+			if err := addFrame(img, float64(i)*sf.feed); err != nil {
+				return nil, options, err
+			}
+		}
+	}
+
+	if sf.processor.Mode == frameprocessor.ModeMultiLine {
+		// the profiles of the lines overlap the ones of the following frames
+		sort.SliceStable(frames, func(i, j int) bool { return frames[i].Position < frames[j].Position })
+		fmt.Fprintf(os.Stderr, "%d of %d rows could not be assigned to the lines and are unresolved\n", unresolved, images*options.Rows)
+	}
+
+	return frames, options, nil
+}
+
+func (sf *scanFlags) scanVideo(filename string, addFrame func(img image.Image, position float64) error) error {
+	handle, err := videoreader.New().Read(filename)
+	if err != nil {
+		return err
+	}
+
+	var positioner heightmap.FramePositioner
+	if sf.motionLog != "" {
+		log, err := motion.Load(sf.motionLog)
+		if err != nil {
+			return err
+		}
+		positioner = log.Positioner(handle.FPS())
+	}
+
+	for {
+		img, err := handle.GetNextImage()
+		if err == videoreader.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read frame: %w", err)
+		}
+
+		position := float64(handle.FrameIndex()) * sf.feed
+		if positioner != nil {
+			position, err = positioner.FramePosition(handle.FrameIndex())
+			if err != nil {
+				return fmt.Errorf("failed to determine position of frame %d: %w", handle.FrameIndex(), err)
+			}
+		}
+		if err := addFrame(img, position); err != nil {
+			return err
+		}
+	}
+}
+
+func isVideo(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, videoExt := range videoExtensions {
+		if ext == videoExt {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readImage(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+
+	return img, nil
+}
+
+// heightMap assembles the scanned frames into a height map, removes outliers,
+// fills holes and levels it if requested
+func (sf *scanFlags) heightMap(frames []pointcloud.Frame, options heightmap.Options) (*heightmap.HeightMap, error) {
+	hm, err := heightmap.New(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create height map: %w", err)
+	}
+	for i, frame := range frames {
+		if err := hm.AddFrameProfileAt(frame.Profile, frame.Image, frame.Position); err != nil {
+			return nil, fmt.Errorf("failed to add frame %d: %w", i, err)
+		}
+	}
+	// every operation on the height map uses the positions of the grid
+	hm.ResampleLateral()
+
+	if sf.medianSize > 0 {
+		removed, err := hm.RemoveMedianOutliers(sf.medianSize, sf.medianDeviation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove median outliers: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "median filter: %d cells removed\n", removed)
+	}
+	if sf.outlierSize > 0 {
+		removed, err := hm.RemoveStatisticalOutliers(sf.outlierSize, sf.outlierStdDevs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove statistical outliers: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "outlier filter: %d cells removed\n", removed)
+	}
+	if sf.fillHoles > 0 {
+		fmt.Fprintf(os.Stderr, "fill holes: %d cells filled\n", hm.FillHoles(sf.fillHoles))
+	}
+
+	if sf.level {
+		result, err := hm.Level(sf.levelOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to level height map: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "plate tilt: %.3f° (%.3f° along X, %.3f° along Y), %d of %d ground cells used\n",
+			result.Plane.TiltDegrees(), result.Plane.TiltXDegrees(), result.Plane.TiltYDegrees(), result.Inliers, result.Candidates)
+	}
+
+	return hm, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Neokil/ltp/internal/export"
+	"github.com/Neokil/ltp/internal/measure"
+)
+
+func runSegment(args []string) error {
+	fs := flag.NewFlagSet("segment", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	options := measure.NewSegmentOptions()
+	output := ""
+	imageOutput := ""
+	fs.Float64Var(&options.Threshold, "threshold", options.Threshold, "cells above this height in mm belong to an object")
+	fs.Float64Var(&options.MinArea, "min-area", options.MinArea, "objects with a smaller footprint in mm² are removed as noise")
+	fs.BoolVar(&options.Diagonal, "diagonal", options.Diagonal, "connect cells that only touch at a corner")
+	fs.BoolVar(&options.IncludeInterpolated, "include-interpolated", options.IncludeInterpolated, "cells filled by -fill-holes belong to objects too")
+	fs.StringVar(&output, "o", "", "write the objects as JSON to this file instead of stdout")
+	fs.StringVar(&imageOutput, "image", "", "write an annotated PNG of the objects to this file")
+	fs.Parse(args)
+
+	frames, hmOptions, err := sf.scan(fs.Args())
+	if err != nil {
+		return err
+	}
+	hm, err := sf.heightMap(frames, hmOptions)
+	if err != nil {
+		return err
+	}
+	seg, err := measure.Segment(hm, options)
+	if err != nil {
+		return fmt.Errorf("failed to segment: %w", err)
+	}
+
+	if imageOutput != "" {
+		if err := writeFile(imageOutput, func(w io.Writer) error {
+			return export.WriteObjectsPNG(w, hm, seg)
+		}); err != nil {
+			return err
+		}
+	}
+
+	writeJSON := func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(seg)
+	}
+	if output != "" {
+		return writeFile(output, writeJSON)
+	}
+
+	return writeJSON(os.Stdout)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/stitch"
+)
+
+func runStitch(args []string) error {
+	fs := flag.NewFlagSet("stitch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: ltp stitch [options] <input@x,y>...\n\n")
+		fmt.Fprintf(fs.Output(), "Every input is one pass, a video or a height map written by \"ltp export -format heightmap\",\n")
+		fmt.Fprintf(fs.Output(), "placed at its nominal offset x,y in mm.\n\n")
+		fs.PrintDefaults()
+	}
+	sf := registerScanFlags(fs)
+	ef := registerExportFlags(fs, "heightmap")
+	options := stitch.NewOptions()
+	report := ""
+	fs.BoolVar(&options.Register, "register", options.Register, "refine the nominal offsets on the overlaps of the passes")
+	fs.Float64Var(&options.Registration.MaxDistance, "max-distance", options.Registration.MaxDistance, "cells of overlapping passes further apart in mm are not paired by the registration")
+	fs.BoolVar(&options.Registration.FitRotation, "fit-rotation", options.Registration.FitRotation, "also fit the rotation of the passes")
+	fs.Float64Var(&options.FeatherWidth, "feather", options.FeatherWidth, "width in mm over which overlapping passes are blended")
+	fs.StringVar(&report, "report", "", "write the offsets and seam residuals as JSON to this file instead of printing them")
+	fs.Parse(args)
+
+	exp, ok := exporters[ef.format]
+	if !ok || ef.format == "csv" {
+		return fmt.Errorf("format \"%s\" is invalid. Valid formats are all except csv of: %s", ef.format, exportFormats())
+	}
+	if ef.output == "" {
+		return fmt.Errorf("no output file given, use -o")
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no passes given")
+	}
+
+	passes := []stitch.Pass{}
+	for _, arg := range fs.Args() {
+		pass, err := sf.pass(arg)
+		if err != nil {
+			return err
+		}
+		passes = append(passes, pass)
+	}
+	result, err := stitch.Stitch(passes, options)
+	if err != nil {
+		return fmt.Errorf("failed to stitch: %w", err)
+	}
+
+	hm, err := ef.heightMap(result.HeightMap)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(ef.output, func(w io.Writer) error {
+		return exp.write(w, ef, nil, hm)
+	}); err != nil {
+		return err
+	}
+
+	if report != "" {
+		return writeFile(report, func(w io.Writer) error {
+			e := json.NewEncoder(w)
+			e.SetIndent("", "  ")
+			return e.Encode(result)
+		})
+	}
+	for _, seam := range result.Seams {
+		if seam.Unconstrained {
+			fmt.Fprintf(os.Stderr, "the overlap of pass %d is too flat to register, kept its nominal x and y\n", seam.Pass)
+		}
+		fmt.Fprintf(os.Stdout, "pass %d at %.3f, %.3f, %.3f mm rotated by %.3f° (shifted %.3f, %.3f mm): %d overlapping cells, RMS %.4f mm, max %.4f mm\n",
+			seam.Pass, seam.Offset.X, seam.Offset.Y, seam.Offset.Z, seam.Offset.RotationDegrees, seam.ShiftX, seam.ShiftY, seam.OverlapCells, seam.RMS, seam.MaxDeviation)
+	}
+
+	return nil
+}
+
+// parses a pass given as input@x,y and scans or loads its height map
+func (sf *scanFlags) pass(arg string) (stitch.Pass, error) {
+	input, offset, ok := strings.Cut(arg, "@")
+	if !ok {
+		return stitch.Pass{}, fmt.Errorf("pass \"%s\" has no offset, use input@x,y", arg)
+	}
+	pass := stitch.Pass{}
+	x, y, ok := strings.Cut(offset, ",")
+	if !ok {
+		return stitch.Pass{}, fmt.Errorf("offset \"%s\" of pass %s needs to be x,y", offset, input)
+	}
+	var err error
+	if pass.OffsetX, err = strconv.ParseFloat(x, 64); err != nil {
+		return stitch.Pass{}, fmt.Errorf("invalid x offset of pass %s: %w", input, err)
+	}
+	if pass.OffsetY, err = strconv.ParseFloat(y, 64); err != nil {
+		return stitch.Pass{}, fmt.Errorf("invalid y offset of pass %s: %w", input, err)
+	}
+
+	if strings.EqualFold(filepath.Ext(input), ".json") {
+		pass.HeightMap, err = heightmap.Load(input)
+		return pass, err
+	}
+	frames, options, err := sf.scan([]string{input})
+	if err != nil {
+		return stitch.Pass{}, err
+	}
+	pass.HeightMap, err = sf.heightMap(frames, options)
+
+	return pass, err
+}
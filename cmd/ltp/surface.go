@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Neokil/ltp/internal/measure"
+	"github.com/Neokil/ltp/internal/surface"
+)
+
+func runSurface(args []string) error {
+	fs := flag.NewFlagSet("surface", flag.ExitOnError)
+	sf := registerScanFlags(fs)
+	options := surface.NewOptions()
+	regions := []measure.Region{}
+	frame := -1
+	output := ""
+	fs.Float64Var(&options.Cutoff, "cutoff", options.Cutoff, "cutoff wavelength λc of the gaussian filter in mm, 0 disables the filter")
+	fs.Func("region", "area to evaluate as name:minX,minY,maxX,maxY in mm, can be repeated (default the whole scan)", func(s string) error {
+		r, err := measure.ParseRegion(s)
+		if err != nil {
+			return err
+		}
+		regions = append(regions, r)
+		return nil
+	})
+	fs.IntVar(&frame, "frame", frame, "only evaluate the profile of this frame, -1 evaluates every frame")
+	fs.StringVar(&output, "o", "", "write the report as JSON to this file instead of stdout")
+	fs.Parse(args)
+
+	frames, hmOptions, err := sf.scan(fs.Args())
+	if err != nil {
+		return err
+	}
+	hm, err := sf.heightMap(frames, hmOptions)
+	if err != nil {
+		return err
+	}
+	if frame >= hm.Frames() {
+		return fmt.Errorf("frame %d does not exist, the scan has %d frames", frame, hm.Frames())
+	}
+
+	profileFrames := []int{}
+	for f := range hm.Frames() {
+		if frame < 0 || f == frame {
+			profileFrames = append(profileFrames, f)
+		}
+	}
+	report, err := surface.NewReport(hm, profileFrames, regions, options)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate surface: %w", err)
+	}
+
+	writeJSON := func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(report)
+	}
+	if output != "" {
+		return writeFile(output, writeJSON)
+	}
+
+	return writeJSON(os.Stdout)
+}
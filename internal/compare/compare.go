@@ -0,0 +1,394 @@
+package compare
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/measure"
+)
+
+// number of reference cells used to align the scan, more cells are subsampled
+const alignmentSamples = 4000
+
+type Options struct {
+	Lower       float64 // lowest allowed deviation from the reference in mm, usually negative
+	Upper       float64 // highest allowed deviation from the reference in mm
+	MinFailArea float64 // connected cells outside the tolerance with a smaller area in mm² are ignored as noise
+	MinCoverage float64 // percentage of the valid reference cells the scan needs to cover
+
+	Align       bool    // align the scan to the reference before comparing
+	MaxShift    float64 // largest translation in mm searched by the alignment
+	MaxRotation float64 // largest rotation in degrees searched by the alignment
+}
+
+func NewOptions() Options {
+	return Options{
+		Lower:       -0.1,
+		Upper:       0.1,
+		MinFailArea: 1,
+		MinCoverage: 90,
+		Align:       true,
+		MaxShift:    5,
+		MaxRotation: 5,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.Lower > 0 || o.Upper < 0 {
+		return fmt.Errorf("the tolerance band from %f to %f needs to contain 0", o.Lower, o.Upper)
+	}
+	if o.MinFailArea < 0 {
+		return fmt.Errorf("MinFailArea needs to be at least 0 but is %f", o.MinFailArea)
+	}
+	if o.MinCoverage < 0 || o.MinCoverage > 100 {
+		return fmt.Errorf("MinCoverage needs to be between 0 and 100 but is %f", o.MinCoverage)
+	}
+	if o.MaxShift < 0 || o.MaxRotation < 0 {
+		return fmt.Errorf("MaxShift and MaxRotation need to be at least 0 but are %f and %f", o.MaxShift, o.MaxRotation)
+	}
+
+	return nil
+}
+
+// Alignment maps a position of the reference onto the scan by rotating it
+// around Center and moving it by X and Y. Z is the height of the scan above
+// the reference. All values are in mm, except the rotation.
+type Alignment struct {
+	X               float64 `json:"x"`
+	Y               float64 `json:"y"`
+	Z               float64 `json:"z"`
+	RotationDegrees float64 `json:"rotation_degrees"`
+	CenterX         float64 `json:"center_x"`
+	CenterY         float64 `json:"center_y"`
+}
+
+// Apply returns the position on the scan of a position on the reference.
+func (a Alignment) Apply(x float64, y float64) (float64, float64) {
+	sin, cos := math.Sincos(a.RotationDegrees * math.Pi / 180)
+	dx, dy := x-a.CenterX, y-a.CenterY
+
+	return a.CenterX + cos*dx - sin*dy + a.X, a.CenterY + sin*dx + cos*dy + a.Y
+}
+
+// CenterAlignment returns the translation that moves the center of the bounds
+// of the reference onto the center of the bounds of the scan. It is a start for
+// the alignment if both are not in the same coordinates, e.g. a CAD model and
+// a scan.
+func CenterAlignment(reference *heightmap.HeightMap, scan *heightmap.HeightMap) Alignment {
+	minX, minY, maxX, maxY := reference.Bounds()
+	a := Alignment{CenterX: (minX + maxX) / 2, CenterY: (minY + maxY) / 2}
+	minX, minY, maxX, maxY = scan.Bounds()
+	a.X = (minX+maxX)/2 - a.CenterX
+	a.Y = (minY+maxY)/2 - a.CenterY
+
+	return a
+}
+
+// Align searches the translation and rotation that map the reference onto the
+// scan with the smallest mean squared height difference, with every difference
+// capped at the width of the tolerance band. A coarse grid search finds the
+// start for a pattern search that refines it.
+func Align(reference *heightmap.HeightMap, scan *heightmap.HeightMap, options Options) (Alignment, error) {
+	minX, minY, maxX, maxY := reference.Bounds()
+
+	return AlignFrom(reference, scan, Alignment{CenterX: (minX + maxX) / 2, CenterY: (minY + maxY) / 2}, options)
+}
+
+// AlignFrom is Align with the search around the given start instead of the
+// identity. MaxShift and MaxRotation limit the distance to the start.
+func AlignFrom(reference *heightmap.HeightMap, scan *heightmap.HeightMap, start Alignment, options Options) (Alignment, error) {
+	if err := options.Validate(); err != nil {
+		return Alignment{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	samples := sampleCells(reference, alignmentSamples)
+	if len(samples) == 0 {
+		return Alignment{}, fmt.Errorf("the reference has no valid cells")
+	}
+
+	minOverlap := float64(len(samples)) * options.MinCoverage / 100
+	capped := (options.Upper - options.Lower) * (options.Upper - options.Lower)
+	cost := func(a Alignment) float64 {
+		sum, n := 0.0, 0
+		for _, s := range samples {
+			h := scan.HeightAt(a.Apply(s[0], s[1]))
+			if math.IsNaN(h) {
+				continue
+			}
+			// residuals are capped at the width of the tolerance band, so
+			// defects do not pull the scan out of place
+			sum += math.Min((h-s[2])*(h-s[2]), capped)
+			n++
+		}
+		if n == 0 || float64(n) < minOverlap {
+			return math.Inf(1)
+		}
+		return sum / float64(n)
+	}
+
+	best, bestCost := start, cost(start)
+	shiftStep := math.Max(options.MaxShift/10, math.Max(reference.RowSpacing, scan.RowSpacing))
+	rotationStep := options.MaxRotation / 4
+	for x := -options.MaxShift; x <= options.MaxShift+1e-9; x += shiftStep {
+		for y := -options.MaxShift; y <= options.MaxShift+1e-9; y += shiftStep {
+			for r := -options.MaxRotation; r <= options.MaxRotation+1e-9; r += math.Max(rotationStep, 1e-9) {
+				a := start
+				a.X, a.Y, a.RotationDegrees = start.X+x, start.Y+y, start.RotationDegrees+r
+				if c := cost(a); c < bestCost {
+					best, bestCost = a, c
+				}
+				if rotationStep == 0 {
+					break
+				}
+			}
+		}
+	}
+	if math.IsInf(bestCost, 1) {
+		return Alignment{}, fmt.Errorf("the scan covers less than %g%% of the reference at every searched position", options.MinCoverage)
+	}
+
+	// moves one parameter at a time and halves the steps if no move improves
+	shiftStep /= 2
+	rotationStep /= 2
+	for shiftStep > 1e-4 || rotationStep > 1e-4 {
+		improved := false
+		for _, move := range []func(a *Alignment, sign float64){
+			func(a *Alignment, sign float64) { a.X += sign * shiftStep },
+			func(a *Alignment, sign float64) { a.Y += sign * shiftStep },
+			func(a *Alignment, sign float64) { a.RotationDegrees += sign * rotationStep },
+		} {
+			for _, sign := range []float64{-1, 1} {
+				a := best
+				move(&a, sign)
+				if math.Abs(a.X-start.X) > options.MaxShift || math.Abs(a.Y-start.Y) > options.MaxShift || math.Abs(a.RotationDegrees-start.RotationDegrees) > options.MaxRotation {
+					continue
+				}
+				if c := cost(a); c < bestCost {
+					best, bestCost = a, c
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			shiftStep /= 2
+			rotationStep /= 2
+		}
+	}
+
+	return best, nil
+}
+
+// returns the positions and heights of about n valid cells spread evenly over
+// the height map
+func sampleCells(hm *heightmap.HeightMap, n int) [][3]float64 {
+	cells := [][3]float64{}
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			if hm.Valid(frame, row) {
+				cells = append(cells, [3]float64{hm.FrameToMM(frame), hm.RowToMM(row), hm.At(frame, row)})
+			}
+		}
+	}
+
+	stride := max(1, len(cells)/n)
+	samples := make([][3]float64, 0, len(cells)/stride+1)
+	for i := 0; i < len(cells); i += stride {
+		samples = append(samples, cells[i])
+	}
+
+	return samples
+}
+
+// FailingRegion is a connected area of cells outside the tolerance band.
+type FailingRegion struct {
+	ID           int            `json:"id"`
+	Direction    string         `json:"direction"` // "above" or "below" the tolerance band
+	Area         float64        `json:"area"`
+	MaxDeviation float64        `json:"max_deviation"` // deviation with the largest magnitude
+	Centroid     measure.Point  `json:"centroid"`
+	Bounds       measure.Region `json:"bounds"`
+}
+
+// Result is the verdict of a comparison. Deviations are scan minus reference
+// in mm on the grid of the reference.
+type Result struct {
+	Pass           bool            `json:"pass"`
+	Reasons        []string        `json:"reasons,omitempty"`
+	Lower          float64         `json:"lower"`
+	Upper          float64         `json:"upper"`
+	Alignment      Alignment       `json:"alignment"`
+	Cells          int             `json:"cells"`          // valid cells of the reference
+	ComparedCells  int             `json:"compared_cells"` // cells that are valid in the reference and the scan
+	Coverage       float64         `json:"coverage"`       // percentage of compared cells
+	CellsAbove     int             `json:"cells_above"`
+	CellsBelow     int             `json:"cells_below"`
+	MinDeviation   float64         `json:"min_deviation"`
+	MaxDeviation   float64         `json:"max_deviation"`
+	RMSDeviation   float64         `json:"rms_deviation"`
+	FailingRegions []FailingRegion `json:"failing_regions"`
+
+	Deviation *heightmap.HeightMap `json:"-"`
+}
+
+// Compare aligns the scan to the reference and checks every cell of the
+// reference against the tolerance band. The part fails if the scan does not
+// cover enough of the reference or if a connected area of at least
+// MinFailArea is outside the tolerance band.
+func Compare(reference *heightmap.HeightMap, scan *heightmap.HeightMap, options Options) (Result, error) {
+	if err := options.Validate(); err != nil {
+		return Result{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	alignment := Alignment{}
+	if options.Align {
+		a, err := Align(reference, scan, options)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to align scan: %w", err)
+		}
+		alignment = a
+	}
+
+	return CompareAligned(reference, scan, alignment, options)
+}
+
+// CompareAligned checks every cell of the reference against the tolerance
+// band like Compare, but uses the given alignment instead of searching one.
+func CompareAligned(reference *heightmap.HeightMap, scan *heightmap.HeightMap, alignment Alignment, options Options) (Result, error) {
+	if err := options.Validate(); err != nil {
+		return Result{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	hmOptions := heightmap.NewOptions()
+	hmOptions.Rows = reference.Rows()
+	hmOptions.RowSpacing = reference.RowSpacing
+	hmOptions.RowOffset = reference.RowOffset
+	deviation, err := heightmap.New(hmOptions)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create deviation map: %w", err)
+	}
+	excess, err := heightmap.New(hmOptions)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create deviation map: %w", err)
+	}
+
+	result := Result{
+		Lower:          options.Lower,
+		Upper:          options.Upper,
+		Alignment:      alignment,
+		MinDeviation:   math.Inf(1),
+		MaxDeviation:   math.Inf(-1),
+		FailingRegions: []FailingRegion{},
+		Deviation:      deviation,
+	}
+	for frame := range reference.Frames() {
+		x := reference.FrameToMM(frame)
+		devs := make([]float64, reference.Rows())
+		outside := make([]float64, reference.Rows())
+		for row := range reference.Rows() {
+			devs[row], outside[row] = math.NaN(), math.NaN()
+			if !reference.Valid(frame, row) {
+				continue
+			}
+			result.Cells++
+
+			h := scan.HeightAt(alignment.Apply(x, reference.RowToMM(row)))
+			if math.IsNaN(h) {
+				continue
+			}
+			d := h - reference.At(frame, row) - alignment.Z
+			devs[row] = d
+			outside[row] = math.Max(0, math.Max(d-options.Upper, options.Lower-d))
+
+			result.ComparedCells++
+			result.MinDeviation = math.Min(result.MinDeviation, d)
+			result.MaxDeviation = math.Max(result.MaxDeviation, d)
+			result.RMSDeviation += d * d
+			if d > options.Upper {
+				result.CellsAbove++
+			} else if d < options.Lower {
+				result.CellsBelow++
+			}
+		}
+		if err := deviation.AddHeightsAt(devs, x); err != nil {
+			return Result{}, fmt.Errorf("failed to add deviations of frame %d: %w", frame, err)
+		}
+		if err := excess.AddHeightsAt(outside, x); err != nil {
+			return Result{}, fmt.Errorf("failed to add deviations of frame %d: %w", frame, err)
+		}
+	}
+
+	if result.Cells > 0 {
+		result.Coverage = 100 * float64(result.ComparedCells) / float64(result.Cells)
+	}
+	if result.ComparedCells > 0 {
+		result.RMSDeviation = math.Sqrt(result.RMSDeviation / float64(result.ComparedCells))
+	} else {
+		result.MinDeviation, result.MaxDeviation = 0, 0
+	}
+
+	regions, err := failingRegions(deviation, excess, options.MinFailArea)
+	if err != nil {
+		return Result{}, err
+	}
+	result.FailingRegions = regions
+
+	if result.Coverage < options.MinCoverage {
+		result.Reasons = append(result.Reasons, fmt.Sprintf("the scan covers %.1f%% of the reference, at least %g%% are needed", result.Coverage, options.MinCoverage))
+	}
+	if len(regions) > 0 {
+		result.Reasons = append(result.Reasons, fmt.Sprintf("%d regions are outside the tolerance band", len(regions)))
+	}
+	result.Pass = len(result.Reasons) == 0
+
+	return result, nil
+}
+
+// segments the cells by how far they are outside the tolerance band
+func failingRegions(deviation *heightmap.HeightMap, excess *heightmap.HeightMap, minArea float64) ([]FailingRegion, error) {
+	options := measure.NewSegmentOptions()
+	options.Threshold = 0
+	options.MinArea = minArea
+	seg, err := measure.Segment(excess, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find failing regions: %w", err)
+	}
+
+	regions := make([]FailingRegion, len(seg.Objects))
+	for i, obj := range seg.Objects {
+		region := FailingRegion{
+			ID:       obj.ID,
+			Area:     obj.Area,
+			Centroid: obj.Centroid,
+			Bounds: measure.Region{
+				Name: fmt.Sprintf("region %d", obj.ID),
+				MinX: obj.BoundingBox.MinX, MinY: obj.BoundingBox.MinY,
+				MaxX: obj.BoundingBox.MaxX, MaxY: obj.BoundingBox.MaxY,
+			},
+		}
+		above := 0
+		for frame := range seg.Labels {
+			for row, id := range seg.Labels[frame] {
+				if id != obj.ID {
+					continue
+				}
+				d := deviation.At(frame, row)
+				if d > 0 {
+					above++
+				} else {
+					above--
+				}
+				if math.Abs(d) > math.Abs(region.MaxDeviation) {
+					region.MaxDeviation = d
+				}
+			}
+		}
+		region.Direction = "below"
+		if above > 0 {
+			region.Direction = "above"
+		}
+		regions[i] = region
+	}
+
+	return regions, nil
+}
@@ -0,0 +1,82 @@
+package compare
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// a smooth part on a flat plate, so the alignment has a clear optimum
+func part(x float64, y float64) float64 {
+	return 3*math.Exp(-((x-14)*(x-14)/30+(y-12)*(y-12)/12)) + 1.5*math.Exp(-((x-20)*(x-20)+(y-20)*(y-20))/10)
+}
+
+// samples the part on a 30x30 grid with 1mm spacing, moved by the alignment
+func newScan(t *testing.T, a Alignment, defect bool) *heightmap.HeightMap {
+	options := heightmap.NewOptions()
+	options.Rows = 30
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sin, cos := math.Sincos(-a.RotationDegrees * math.Pi / 180)
+	for frame := range 30 {
+		heights := make([]float64, 30)
+		for row := range heights {
+			// position on the reference that ends up at this cell
+			dx, dy := float64(frame)-a.X-a.CenterX, float64(row)-a.Y-a.CenterY
+			heights[row] = part(a.CenterX+cos*dx-sin*dy, a.CenterY+sin*dx+cos*dy)
+			if defect && frame >= 8 && frame < 11 && row >= 20 && row < 23 {
+				heights[row] += 0.5
+			}
+		}
+		if err := hm.AddHeightsAt(heights, float64(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return hm
+}
+
+func TestCompare(t *testing.T) {
+	reference := newScan(t, Alignment{CenterX: 14.5, CenterY: 14.5}, false)
+	moved := Alignment{X: 1.3, Y: -0.7, RotationDegrees: 2, CenterX: 14.5, CenterY: 14.5}
+
+	tests := []struct {
+		name    string
+		scan    *heightmap.HeightMap
+		pass    bool
+		regions int
+	}{
+		{name: "good part", scan: newScan(t, moved, false), pass: true, regions: 0},
+		{name: "part with defect", scan: newScan(t, moved, true), pass: false, regions: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewOptions()
+			options.MaxShift = 3
+			options.MaxRotation = 3
+			options.MinCoverage = 70
+
+			result, err := Compare(reference, tt.scan, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := result.Alignment
+			if math.Abs(a.X-moved.X) > 0.05 || math.Abs(a.Y-moved.Y) > 0.05 || math.Abs(a.RotationDegrees-moved.RotationDegrees) > 0.2 {
+				t.Errorf("Compare() aligned with %+v, want %+v", a, moved)
+			}
+			if result.Pass != tt.pass || len(result.FailingRegions) != tt.regions {
+				t.Fatalf("Compare() pass = %t with %d failing regions, want %t with %d: %v", result.Pass, len(result.FailingRegions), tt.pass, tt.regions, result.Reasons)
+			}
+			if tt.regions > 0 {
+				r := result.FailingRegions[0]
+				if r.Direction != "above" || math.Abs(r.MaxDeviation-0.5) > 0.05 {
+					t.Errorf("failing region is %s with %f, want above with 0.5", r.Direction, r.MaxDeviation)
+				}
+			}
+		})
+	}
+}
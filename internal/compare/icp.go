@@ -0,0 +1,235 @@
+package compare
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/linalg"
+)
+
+// ErrUnconstrained is returned by ICP if the paired cells are too flat to fix
+// the translation, e.g. if the overlap of two passes is bare plate.
+var ErrUnconstrained = errors.New("the paired cells do not constrain the alignment, the part needs edges or slopes")
+
+type ICPOptions struct {
+	Iterations    int     // maximum number of iterations
+	MaxDistance   float64 // point pairs further apart in mm are not used, so areas missing in one of the height maps do not pull
+	Samples       int     // number of reference cells used
+	FitRotation   bool    // fit the rotation about Z, otherwise only the translation is fitted
+	FitZ          bool    // also fit the height offset, otherwise the part is assumed to lie on the plate at the same height as the reference
+	MinConstraint float64 // smallest mean squared slope of the paired cells in any direction, ICP fails with ErrUnconstrained on flatter cells
+}
+
+func NewICPOptions() ICPOptions {
+	return ICPOptions{
+		Iterations:    50,
+		MaxDistance:   1,
+		Samples:       10000,
+		FitRotation:   true,
+		MinConstraint: 0.01,
+	}
+}
+
+func (o ICPOptions) Validate() error {
+	if o.Iterations < 1 {
+		return fmt.Errorf("Iterations needs to be at least 1 but is %d", o.Iterations)
+	}
+	if o.MaxDistance <= 0 {
+		return fmt.Errorf("MaxDistance needs to be greater than 0 but is %f", o.MaxDistance)
+	}
+	if o.Samples < 3 {
+		return fmt.Errorf("Samples needs to be at least 3 but is %d", o.Samples)
+	}
+	if o.MinConstraint < 0 {
+		return fmt.Errorf("MinConstraint needs to be at least 0 but is %f", o.MinConstraint)
+	}
+
+	return nil
+}
+
+// ICP refines the alignment of the reference onto the scan with the iterative
+// closest point algorithm. Every iteration pairs the reference cells with the
+// closest scan cells in 3D and solves the rotation about Z and the translation
+// that minimize the distances to the tangent planes of the scan at the paired
+// cells. Point to plane distances let the reference slide along flat areas
+// instead of snapping every cell onto the scan grid. The part is assumed to
+// lie flat on the plate, so it is not tilted. It returns the alignment and the
+// RMS distance of the pairs, or ErrUnconstrained if the paired cells are
+// too flat in some direction to fit the translation along it.
+func ICP(reference *heightmap.HeightMap, scan *heightmap.HeightMap, start Alignment, options ICPOptions) (Alignment, float64, error) {
+	if err := options.Validate(); err != nil {
+		return Alignment{}, 0, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	samples := sampleCells(reference, options.Samples)
+	index := newPointIndex(scan, options.MaxDistance)
+	// the fitted unknowns out of the rotation in radians, X, Y and Z
+	unknowns := []int{1, 2}
+	if options.FitRotation {
+		unknowns = append([]int{0}, unknowns...)
+	}
+	if options.FitZ {
+		unknowns = append(unknowns, 3)
+	}
+	alignment := start
+	rms := math.Inf(1)
+	for range options.Iterations {
+		m := make([][]float64, len(unknowns))
+		for i := range m {
+			m[i] = make([]float64, len(unknowns))
+		}
+		v := make([]float64, len(unknowns))
+		pairs := 0
+		sum := 0.0
+		// horizontal components of the normals, they fix the translation
+		var sxx, sxy, syy float64
+		// the rotation is applied around the center moved onto the scan
+		cx, cy := alignment.CenterX+alignment.X, alignment.CenterY+alignment.Y
+		for _, p := range samples {
+			x, y := alignment.Apply(p[0], p[1])
+			z := p[2] + alignment.Z
+			q, n, ok := index.nearest([3]float64{x, y, z})
+			if !ok {
+				continue
+			}
+			d := n[0]*(x-q[0]) + n[1]*(y-q[1]) + n[2]*(z-q[2])
+			j := [4]float64{n[1]*(x-cx) - n[0]*(y-cy), n[0], n[1], n[2]}
+			for a, ua := range unknowns {
+				for b, ub := range unknowns {
+					m[a][b] += j[ua] * j[ub]
+				}
+				v[a] -= j[ua] * d
+			}
+			pairs++
+			sum += d * d
+			sxx += n[0] * n[0]
+			sxy += n[0] * n[1]
+			syy += n[1] * n[1]
+		}
+		if pairs < len(unknowns) {
+			return Alignment{}, 0, fmt.Errorf("only %d reference cells are within %g mm of the scan", pairs, options.MaxDistance)
+		}
+		rms = math.Sqrt(sum / float64(pairs))
+		// smaller eigenvalue of the horizontal normals, the flattest direction
+		flattest := (sxx+syy)/2 - math.Hypot((sxx-syy)/2, sxy)
+		if flattest/float64(pairs) < options.MinConstraint {
+			return Alignment{}, 0, ErrUnconstrained
+		}
+
+		solution, ok := linalg.Solve(m, v)
+		if !ok {
+			return Alignment{}, 0, ErrUnconstrained
+		}
+		step := [4]float64{}
+		for i, u := range unknowns {
+			step[u] = solution[i]
+		}
+		alignment.RotationDegrees += step[0] * 180 / math.Pi
+		alignment.X += step[1]
+		alignment.Y += step[2]
+		alignment.Z += step[3]
+		if math.Abs(step[0]) < 1e-8 && math.Hypot(step[1], step[2]) < 1e-6 && math.Abs(step[3]) < 1e-6 {
+			break
+		}
+	}
+
+	return alignment, rms, nil
+}
+
+// Register aligns the reference onto the scan with the coarse search of
+// AlignFrom around start and refines the result with ICP. It returns the
+// alignment and the RMS distance of the ICP pairs.
+func Register(reference *heightmap.HeightMap, scan *heightmap.HeightMap, start Alignment, options Options, icpOptions ICPOptions) (Alignment, float64, error) {
+	alignment, err := AlignFrom(reference, scan, start, options)
+	if err != nil {
+		return Alignment{}, 0, fmt.Errorf("failed to align scan: %w", err)
+	}
+
+	return ICP(reference, scan, alignment, icpOptions)
+}
+
+// pointIndex finds the closest valid cell of a height map in 3D by hashing the
+// cells into buckets of the search radius
+type pointIndex struct {
+	radius  float64
+	buckets map[[2]int][]indexedPoint
+}
+
+type indexedPoint struct {
+	position [3]float64
+	normal   [3]float64
+}
+
+func newPointIndex(hm *heightmap.HeightMap, radius float64) *pointIndex {
+	index := &pointIndex{radius: radius, buckets: map[[2]int][]indexedPoint{}}
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			p := indexedPoint{
+				position: [3]float64{hm.FrameToMM(frame), hm.RowToMM(row), hm.At(frame, row)},
+				normal:   surfaceNormal(hm, frame, row),
+			}
+			key := index.key(p.position[0], p.position[1])
+			index.buckets[key] = append(index.buckets[key], p)
+		}
+	}
+
+	return index
+}
+
+// returns the normal of the surface at the cell from the slopes to its valid
+// neighbours
+func surfaceNormal(hm *heightmap.HeightMap, frame int, row int) [3]float64 {
+	slope := func(before [2]int, after [2]int) float64 {
+		valid := func(c [2]int) bool {
+			return c[0] >= 0 && c[0] < hm.Frames() && c[1] >= 0 && c[1] < hm.Rows() && hm.Valid(c[0], c[1])
+		}
+		center := [2]int{frame, row}
+		if !valid(before) {
+			before = center
+		}
+		if !valid(after) {
+			after = center
+		}
+		distance := math.Hypot(hm.FrameToMM(after[0])-hm.FrameToMM(before[0]), hm.RowToMM(after[1])-hm.RowToMM(before[1]))
+		if distance == 0 {
+			return 0
+		}
+
+		return (hm.At(after[0], after[1]) - hm.At(before[0], before[1])) / distance
+	}
+	dx := slope([2]int{frame - 1, row}, [2]int{frame + 1, row})
+	dy := slope([2]int{frame, row - 1}, [2]int{frame, row + 1})
+	length := math.Sqrt(dx*dx + dy*dy + 1)
+
+	return [3]float64{-dx / length, -dy / length, 1 / length}
+}
+
+func (index *pointIndex) key(x float64, y float64) [2]int {
+	return [2]int{int(math.Floor(x / index.radius)), int(math.Floor(y / index.radius))}
+}
+
+// returns the closest point within the radius and the surface normal at it
+func (index *pointIndex) nearest(p [3]float64) ([3]float64, [3]float64, bool) {
+	center := index.key(p[0], p[1])
+	best, bestDistance := indexedPoint{}, math.Inf(1)
+	for kx := center[0] - 1; kx <= center[0]+1; kx++ {
+		for ky := center[1] - 1; ky <= center[1]+1; ky++ {
+			for _, q := range index.buckets[[2]int{kx, ky}] {
+				d := math.Sqrt((p[0]-q.position[0])*(p[0]-q.position[0]) + (p[1]-q.position[1])*(p[1]-q.position[1]) + (p[2]-q.position[2])*(p[2]-q.position[2]))
+				if d < bestDistance {
+					best, bestDistance = q, d
+				}
+			}
+		}
+	}
+	if bestDistance > index.radius {
+		return [3]float64{}, [3]float64{}, false
+	}
+
+	return best.position, best.normal, true
+}
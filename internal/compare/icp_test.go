@@ -0,0 +1,95 @@
+package compare
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/mesh"
+)
+
+// renders a frustum with a 12x8mm base and a 6x4mm top 3mm above it, rotated
+// around (10, 10) and moved by the alignment
+func newFrustum(t *testing.T, a Alignment) *heightmap.HeightMap {
+	corners := []mesh.Vec3{
+		{X: 4, Y: 6}, {X: 16, Y: 6}, {X: 16, Y: 14}, {X: 4, Y: 14},
+		{X: 7, Y: 8, Z: 3}, {X: 13, Y: 8, Z: 3}, {X: 13, Y: 12, Z: 3}, {X: 7, Y: 12, Z: 3},
+	}
+	m := &mesh.Mesh{Triangles: []mesh.Triangle{
+		{4, 5, 6}, {4, 6, 7}, // top
+		{0, 1, 5}, {0, 5, 4}, {1, 2, 6}, {1, 6, 5}, {2, 3, 7}, {2, 7, 6}, {3, 0, 4}, {3, 4, 7}, // sides
+		{0, 2, 1}, {0, 3, 2}, // bottom
+	}}
+	for _, c := range corners {
+		x, y := a.Apply(c.X, c.Y)
+		m.Vertices = append(m.Vertices, mesh.Vec3{X: x, Y: y, Z: c.Z})
+	}
+
+	options := mesh.NewRenderOptions()
+	options.SpacingX = 0.2
+	options.SpacingY = 0.2
+	hm, err := m.RenderHeightMap(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hm
+}
+
+func TestRegister(t *testing.T) {
+	reference := newFrustum(t, Alignment{CenterX: 10, CenterY: 10})
+	moved := Alignment{X: 1.1, Y: -0.6, RotationDegrees: 2.5, CenterX: 10, CenterY: 10}
+	scan := newFrustum(t, moved)
+
+	tests := []struct {
+		name     string
+		register func() (Alignment, float64, error)
+	}{
+		{name: "with the coarse alignment", register: func() (Alignment, float64, error) {
+			return Register(reference, scan, Alignment{CenterX: 10, CenterY: 10}, NewOptions(), NewICPOptions())
+		}},
+		{name: "only ICP", register: func() (Alignment, float64, error) {
+			options := NewICPOptions()
+			options.MaxDistance = 2
+			return ICP(reference, scan, Alignment{CenterX: 10, CenterY: 10}, options)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rms, err := tt.register()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the alignment is relative to the center of the reference
+			x, y := got.Apply(10, 10)
+			wantX, wantY := moved.Apply(10, 10)
+			if math.Hypot(x-wantX, y-wantY) > 0.05 || math.Abs(got.RotationDegrees-moved.RotationDegrees) > 0.2 {
+				t.Errorf("Register() = %+v, want %+v", got, moved)
+			}
+			if rms > 0.1 {
+				t.Errorf("Register() has a RMS distance of %f", rms)
+			}
+		})
+	}
+}
+
+func TestCenterAlignment(t *testing.T) {
+	reference := newFrustum(t, Alignment{CenterX: 10, CenterY: 10})
+	// moved further than the coarse alignment searches
+	moved := Alignment{X: 30, Y: -20, RotationDegrees: 2.5, CenterX: 10, CenterY: 10}
+	scan := newFrustum(t, moved)
+
+	start := CenterAlignment(reference, scan)
+	if _, _, err := Register(reference, scan, Alignment{CenterX: 10, CenterY: 10}, NewOptions(), NewICPOptions()); err == nil {
+		t.Errorf("Register() from the identity succeeded, want an error")
+	}
+	got, _, err := Register(reference, scan, start, NewOptions(), NewICPOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := got.Apply(10, 10)
+	wantX, wantY := moved.Apply(10, 10)
+	if math.Hypot(x-wantX, y-wantY) > 0.05 || math.Abs(got.RotationDegrees-moved.RotationDegrees) > 0.2 {
+		t.Errorf("Register() from the centers = %+v, want %+v", got, moved)
+	}
+}
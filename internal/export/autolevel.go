@@ -0,0 +1,196 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// ProbeGrid is a height map resampled onto a regular XY grid like the one a
+// CNC machine would probe. Heights are indexed by [y][x].
+type ProbeGrid struct {
+	OriginX, OriginY   float64
+	SpacingX, SpacingY float64
+	Heights            [][]float64
+}
+
+type ProbeGridOptions struct {
+	OriginX, OriginY   float64 // position of the first probe point in scan coordinates (mm)
+	SpacingX, SpacingY float64 // distance between two probe points in mm
+	CountX, CountY     int     // number of probe points, 0 to cover the whole scan starting at its edge (the origin is ignored then)
+	FillMissing        bool    // use the nearest probed height for points without a measurement instead of failing
+}
+
+func NewProbeGridOptions() ProbeGridOptions {
+	return ProbeGridOptions{
+		SpacingX:    10,
+		SpacingY:    10,
+		FillMissing: true,
+	}
+}
+
+func (o ProbeGridOptions) Validate() error {
+	if o.SpacingX <= 0 || o.SpacingY <= 0 {
+		return fmt.Errorf("the probe spacing needs to be greater than 0 but is %f x %f", o.SpacingX, o.SpacingY)
+	}
+	if o.CountX < 0 || o.CountY < 0 {
+		return fmt.Errorf("the number of probe points can not be negative but is %d x %d", o.CountX, o.CountY)
+	}
+
+	return nil
+}
+
+// ResampleProbeGrid samples the height map at every point of the probe grid.
+func ResampleProbeGrid(hm *heightmap.HeightMap, options ProbeGridOptions) (*ProbeGrid, error) {
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	minX, minY, maxX, maxY := hm.Bounds()
+	if options.CountX == 0 {
+		options.OriginX = minX
+		options.CountX = int(math.Floor((maxX-options.OriginX)/options.SpacingX)) + 1
+	}
+	if options.CountY == 0 {
+		options.OriginY = minY
+		options.CountY = int(math.Floor((maxY-options.OriginY)/options.SpacingY)) + 1
+	}
+	if options.CountX < 1 || options.CountY < 1 {
+		return nil, fmt.Errorf("the probe grid does not overlap with the scan")
+	}
+
+	grid := &ProbeGrid{
+		OriginX:  options.OriginX,
+		OriginY:  options.OriginY,
+		SpacingX: options.SpacingX,
+		SpacingY: options.SpacingY,
+		Heights:  make([][]float64, options.CountY),
+	}
+	missing := 0
+	for iy := range options.CountY {
+		grid.Heights[iy] = make([]float64, options.CountX)
+		for ix := range options.CountX {
+			x, y := grid.Position(ix, iy)
+			grid.Heights[iy][ix] = hm.HeightAt(x, y)
+			if math.IsNaN(grid.Heights[iy][ix]) {
+				missing++
+			}
+		}
+	}
+
+	if missing == options.CountX*options.CountY {
+		return nil, fmt.Errorf("none of the %d probe points has a measurement", missing)
+	}
+	if missing > 0 {
+		if !options.FillMissing {
+			return nil, fmt.Errorf("%d of %d probe points have no measurement", missing, options.CountX*options.CountY)
+		}
+		grid.fillMissing()
+	}
+
+	return grid, nil
+}
+
+// Position returns the position of a probe point in mm.
+func (g *ProbeGrid) Position(ix int, iy int) (float64, float64) {
+	return g.OriginX + float64(ix)*g.SpacingX, g.OriginY + float64(iy)*g.SpacingY
+}
+
+// replaces every missing height by the nearest measured one
+func (g *ProbeGrid) fillMissing() {
+	filled := make([][]float64, len(g.Heights))
+	for iy := range g.Heights {
+		filled[iy] = make([]float64, len(g.Heights[iy]))
+		for ix, h := range g.Heights[iy] {
+			filled[iy][ix] = h
+			if !math.IsNaN(h) {
+				continue
+			}
+
+			best := math.Inf(1)
+			for jy := range g.Heights {
+				for jx, other := range g.Heights[jy] {
+					if math.IsNaN(other) {
+						continue
+					}
+					dist := math.Hypot(float64(jx-ix)*g.SpacingX, float64(jy-iy)*g.SpacingY)
+					if dist < best {
+						best = dist
+						filled[iy][ix] = other
+					}
+				}
+			}
+		}
+	}
+	g.Heights = filled
+}
+
+type ProbeGCodeOptions struct {
+	SafeZ      float64 // height to move between probe points
+	ProbeDepth float64 // Z target of the G38.2 move
+	ProbeFeed  float64 // feed rate of the probe move in mm/min
+	OffsetX    float64 // added to the X coordinates to convert scan into machine coordinates
+	OffsetY    float64 // added to the Y coordinates to convert scan into machine coordinates
+	OffsetZ    float64 // added to the scanned heights, e.g. the Z of the scan bed in machine coordinates
+}
+
+func NewProbeGCodeOptions() ProbeGCodeOptions {
+	return ProbeGCodeOptions{
+		SafeZ:      5,
+		ProbeDepth: -2,
+		ProbeFeed:  50,
+	}
+}
+
+// WriteProbeGCode writes a G38.2 probing program for the grid. The scanned
+// height of every point is written as "PROBE" comment after its probe move,
+// the same way senders log the result of a real probe.
+func WriteProbeGCode(w io.Writer, grid *ProbeGrid, options ProbeGCodeOptions) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "; ltp autolevel probe grid\n")
+	fmt.Fprintf(bw, "; origin X%s Y%s, spacing X%s Y%s, %d x %d points\n",
+		formatFloat(grid.OriginX+options.OffsetX), formatFloat(grid.OriginY+options.OffsetY),
+		formatFloat(grid.SpacingX), formatFloat(grid.SpacingY), len(grid.Heights[0]), len(grid.Heights))
+	fmt.Fprintf(bw, "G21 ; mm\nG90 ; absolute positioning\nG0 Z%.3f\n", options.SafeZ)
+
+	for iy := range grid.Heights {
+		for ix, h := range grid.Heights[iy] {
+			x, y := grid.Position(ix, iy)
+			x += options.OffsetX
+			y += options.OffsetY
+			fmt.Fprintf(bw, "G0 X%.3f Y%.3f\n", x, y)
+			fmt.Fprintf(bw, "G38.2 Z%.3f F%.0f\n", options.ProbeDepth, options.ProbeFeed)
+			fmt.Fprintf(bw, "; PROBE X%.3f Y%.3f Z%.4f\n", x, y, h+options.OffsetZ)
+			fmt.Fprintf(bw, "G0 Z%.3f\n", options.SafeZ)
+		}
+	}
+	fmt.Fprintf(bw, "M2\n")
+
+	return bw.Flush()
+}
+
+// WriteProbeGrid writes the grid in a plain text format: origin, spacing and
+// size followed by one line of heights per Y position.
+func WriteProbeGrid(w io.Writer, grid *ProbeGrid) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "# ltp autolevel height map, units are mm, one line per Y starting at the origin\n")
+	fmt.Fprintf(bw, "ORIGIN %s %s\n", formatFloat(grid.OriginX), formatFloat(grid.OriginY))
+	fmt.Fprintf(bw, "SPACING %s %s\n", formatFloat(grid.SpacingX), formatFloat(grid.SpacingY))
+	fmt.Fprintf(bw, "SIZE %d %d\n", len(grid.Heights[0]), len(grid.Heights))
+	for _, heights := range grid.Heights {
+		for ix, h := range heights {
+			if ix > 0 {
+				fmt.Fprint(bw, " ")
+			}
+			fmt.Fprintf(bw, "%.4f", h)
+		}
+		fmt.Fprint(bw, "\n")
+	}
+
+	return bw.Flush()
+}
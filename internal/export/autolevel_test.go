@@ -0,0 +1,65 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestResampleProbeGrid(t *testing.T) {
+	hm := newTestHeightMap(t)
+
+	options := NewProbeGridOptions()
+	options.SpacingX = 1
+	options.SpacingY = 1
+	grid, err := ResampleProbeGrid(hm, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// frame 1 row 1 has no measurement and gets the nearest probed height
+	want := [][]float64{{0, 0.5}, {1, 0.5}, {2, 4}}
+	for iy := range want {
+		for ix := range want[iy] {
+			if grid.Heights[iy][ix] != want[iy][ix] {
+				t.Errorf("probe point %d,%d = %f, want %f", ix, iy, grid.Heights[iy][ix], want[iy][ix])
+			}
+		}
+	}
+
+	options.FillMissing = false
+	if _, err := ResampleProbeGrid(hm, options); err == nil {
+		t.Errorf("ResampleProbeGrid() without FillMissing should fail for points without a measurement")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteProbeGrid(buf, grid); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "ORIGIN 0 0\nSPACING 1 1\nSIZE 2 3\n0.0000 0.5000\n") {
+		t.Errorf("WriteProbeGrid() = %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteProbeGCode(buf, grid, NewProbeGCodeOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(buf.String(), "G38.2") != 6 {
+		t.Errorf("WriteProbeGCode() wrote %d probe moves, want 6", strings.Count(buf.String(), "G38.2"))
+	}
+	if !strings.Contains(buf.String(), "; PROBE X1.000 Y2.000 Z4.0000\n") {
+		t.Errorf("WriteProbeGCode() is missing the probe result of the last point:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	gcodeOptions := NewProbeGCodeOptions()
+	gcodeOptions.OffsetX = 10
+	gcodeOptions.OffsetY = 20
+	gcodeOptions.OffsetZ = -1.5
+	if err := WriteProbeGCode(buf, grid, gcodeOptions); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "; PROBE X11.000 Y22.000 Z2.5000\n") {
+		t.Errorf("WriteProbeGCode() with offsets is missing the probe result of the last point:\n%s", buf.String())
+	}
+}
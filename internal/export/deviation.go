@@ -0,0 +1,91 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+var (
+	toleranceLowColor  = color.RGBA{R: 170, G: 220, B: 120, A: 255}
+	toleranceZeroColor = color.RGBA{R: 30, G: 160, B: 60, A: 255}
+	belowColors        = [2]color.RGBA{{R: 80, G: 150, B: 255, A: 255}, {R: 10, G: 20, B: 130, A: 255}}
+	aboveColors        = [2]color.RGBA{{R: 255, G: 150, B: 60, A: 255}, {R: 150, G: 10, B: 10, A: 255}}
+)
+
+// DeviationColor returns the color of a deviation. Deviations within the
+// tolerance band are green, the further outside the band the darker blue
+// (below) or red (above) they become, up to twice the tolerance.
+func DeviationColor(deviation float64, lower float64, upper float64) color.RGBA {
+	switch {
+	case deviation > upper:
+		return mixColor(aboveColors[0], aboveColors[1], fraction(deviation-upper, upper))
+	case deviation < lower:
+		return mixColor(belowColors[0], belowColors[1], fraction(lower-deviation, -lower))
+	case deviation >= 0:
+		return mixColor(toleranceZeroColor, toleranceLowColor, fraction(deviation, upper))
+	default:
+		return mixColor(toleranceZeroColor, toleranceLowColor, fraction(-deviation, -lower))
+	}
+}
+
+// RenderDeviation renders a deviation map with DeviationColor and a legend
+// from twice the lower to twice the upper tolerance. Cells without a deviation
+// are black.
+func RenderDeviation(deviation *heightmap.HeightMap, lower float64, upper float64) *image.RGBA {
+	lo, hi := 2*lower, 2*upper
+	height := max(deviation.Rows(), legendMinHeight())
+	img := image.NewRGBA(image.Rect(0, 0, deviation.Frames()+legendWidth(lo, hi), height))
+	for y := range height {
+		for x := range img.Bounds().Dx() {
+			img.SetRGBA(x, y, noDataColor)
+		}
+	}
+
+	for frame := range deviation.Frames() {
+		for row := range deviation.Rows() {
+			d := deviation.At(frame, row)
+			if math.IsNaN(d) {
+				continue
+			}
+			img.SetRGBA(frame, row, DeviationColor(d, lower, upper))
+		}
+	}
+
+	drawLegend(img, deviation.Frames()+legendMargin, lo, hi, func(value float64) color.RGBA {
+		return DeviationColor(lo+value*(hi-lo), lower, upper)
+	})
+
+	return img
+}
+
+// WriteDeviationPNG writes the rendering of the deviation map as PNG.
+func WriteDeviationPNG(w io.Writer, deviation *heightmap.HeightMap, lower float64, upper float64) error {
+	if err := png.Encode(w, RenderDeviation(deviation, lower, upper)); err != nil {
+		return fmt.Errorf("failed to encode png: %w", err)
+	}
+
+	return nil
+}
+
+// returns value / limit clamped to 0..1, 1 for an empty band
+func fraction(value float64, limit float64) float64 {
+	if limit <= 0 {
+		return 1
+	}
+
+	return math.Max(0, math.Min(1, value/limit))
+}
+
+func mixColor(a color.RGBA, b color.RGBA, f float64) color.RGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + f*(float64(b)-float64(a))))
+	}
+
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 255}
+}
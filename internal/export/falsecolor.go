@@ -0,0 +1,211 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// stops of the color scale from low to high
+var falseColorStops = []color.RGBA{
+	{R: 48, G: 18, B: 59, A: 255},
+	{R: 70, G: 131, B: 247, A: 255},
+	{R: 26, G: 228, B: 182, A: 255},
+	{R: 164, G: 252, B: 60, A: 255},
+	{R: 251, G: 185, B: 56, A: 255},
+	{R: 228, G: 70, B: 9, A: 255},
+	{R: 122, G: 4, B: 3, A: 255},
+}
+
+var (
+	noDataColor     = color.RGBA{R: 0, G: 0, B: 0, A: 255}
+	legendTextColor = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+const (
+	legendUnit     = " mm"
+	legendBarWidth = 12
+	legendMargin   = 4
+	glyphScale     = 2
+)
+
+// FalseColor maps a value between 0 and 1 onto the color scale.
+func FalseColor(value float64) color.RGBA {
+	value = math.Max(0, math.Min(1, value))
+	pos := value * float64(len(falseColorStops)-1)
+	i := int(pos)
+	if i >= len(falseColorStops)-1 {
+		return falseColorStops[len(falseColorStops)-1]
+	}
+	f := pos - float64(i)
+	c1 := falseColorStops[i]
+	c2 := falseColorStops[i+1]
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + f*(float64(b)-float64(a))))
+	}
+
+	return color.RGBA{R: mix(c1.R, c2.R), G: mix(c1.G, c2.G), B: mix(c1.B, c2.B), A: 255}
+}
+
+// RenderFalseColor renders the height map as 8-bit false-color image with a
+// legend on the right. The x-axis are the frames and the y-axis the rows,
+// cells without a measurement are black.
+func RenderFalseColor(hm *heightmap.HeightMap) *image.RGBA {
+	lo, hi, ok := hm.Range()
+	if !ok {
+		lo, hi = 0, 0
+	}
+
+	height := max(hm.Rows(), legendMinHeight())
+	img := image.NewRGBA(image.Rect(0, 0, hm.Frames()+legendWidth(lo, hi), height))
+	for y := range height {
+		for x := range img.Bounds().Dx() {
+			img.SetRGBA(x, y, noDataColor)
+		}
+	}
+
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			h := hm.At(frame, row)
+			if math.IsNaN(h) {
+				continue
+			}
+			value := 0.0
+			if hi > lo {
+				value = (h - lo) / (hi - lo)
+			}
+			img.SetRGBA(frame, row, FalseColor(value))
+		}
+	}
+
+	drawLegend(img, hm.Frames()+legendMargin, lo, hi, FalseColor)
+
+	return img
+}
+
+// WriteFalseColorPNG writes the false-color rendering of the height map as PNG.
+func WriteFalseColorPNG(w io.Writer, hm *heightmap.HeightMap) error {
+	if err := png.Encode(w, RenderFalseColor(hm)); err != nil {
+		return fmt.Errorf("failed to encode png: %w", err)
+	}
+
+	return nil
+}
+
+// the legend is as wide as the bar and the widest of its labels
+func legendWidth(lo float64, hi float64) int {
+	width := 0
+	for _, label := range legendLabels(lo, hi) {
+		width = max(width, textWidth(label))
+	}
+
+	return legendMargin + legendBarWidth + legendMargin + width + legendMargin
+}
+
+// returns the labels of the highest value, the middle and the lowest value with the unit
+func legendLabels(lo float64, hi float64) [3]string {
+	return [3]string{
+		formatLegendValue(hi) + legendUnit,
+		formatLegendValue((lo+hi)/2) + legendUnit,
+		formatLegendValue(lo) + legendUnit,
+	}
+}
+
+func legendMinHeight() int {
+	// three labels need to fit next to the bar
+	return 3*(glyphHeight+1)*glyphScale + 2*legendMargin
+}
+
+// the bar goes from hi at the top to lo at the bottom, labels are placed at
+// the top, middle and bottom. scale maps a value between 0 (lo) and 1 (hi)
+// onto its color.
+func drawLegend(img *image.RGBA, left int, lo float64, hi float64, scale func(value float64) color.RGBA) {
+	top := legendMargin
+	bottom := img.Bounds().Dy() - legendMargin - 1
+	for y := top; y <= bottom; y++ {
+		value := 1 - float64(y-top)/float64(bottom-top)
+		for x := left; x < left+legendBarWidth; x++ {
+			img.SetRGBA(x, y, scale(value))
+		}
+	}
+
+	labelLeft := left + legendBarWidth + legendMargin
+	labelHeight := glyphHeight * glyphScale
+	labels := legendLabels(lo, hi)
+	drawText(img, labelLeft, top, labels[0])
+	drawText(img, labelLeft, (top+bottom-labelHeight)/2, labels[1])
+	drawText(img, labelLeft, bottom-labelHeight+1, labels[2])
+}
+
+func formatLegendValue(v float64) string {
+	precision := 2
+	if math.Abs(v) >= 100 {
+		precision = 0
+	} else if math.Abs(v) >= 10 {
+		precision = 1
+	}
+
+	return strconv.FormatFloat(v, 'f', precision, 64)
+}
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// minimal font for the legend labels
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", "..#", "..#", "..#"},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'.': {"...", "...", "...", "...", ".#."},
+	'-': {"...", "...", "###", "...", "..."},
+	'm': {"...", "#.#", "###", "#.#", "#.#"},
+	' ': {"...", "...", "...", "...", "..."},
+}
+
+// returns the width of the text in pixel, without the space after the last
+// glyph
+func textWidth(text string) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+
+	return n*(glyphWidth+1)*glyphScale - glyphScale
+}
+
+func drawText(img *image.RGBA, left int, top int, text string) {
+	for i, r := range text {
+		glyph, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+		x0 := left + i*(glyphWidth+1)*glyphScale
+		for gy, line := range glyph {
+			for gx, pixel := range line {
+				if pixel != '#' {
+					continue
+				}
+				for sy := range glyphScale {
+					for sx := range glyphScale {
+						img.SetRGBA(x0+gx*glyphScale+sx, top+gy*glyphScale+sy, legendTextColor)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// HeightEncoding maps heights onto 16-bit pixel values with
+// height = value * Scale + Offset. The value 0 is reserved for cells without
+// a measurement.
+type HeightEncoding struct {
+	Scale  float64 // mm per pixel value
+	Offset float64 // height in mm of pixel value 0
+}
+
+// NewHeightEncoding spreads the range of the height map over the pixel values
+// 1 to 65535.
+func NewHeightEncoding(hm *heightmap.HeightMap) HeightEncoding {
+	min, max, ok := hm.Range()
+	if !ok {
+		return HeightEncoding{Scale: 1, Offset: 0}
+	}
+
+	scale := (max - min) / (math.MaxUint16 - 1)
+	if scale == 0 {
+		scale = 0.001
+	}
+
+	return HeightEncoding{Scale: scale, Offset: min - scale}
+}
+
+func (e HeightEncoding) encode(height float64) uint16 {
+	if math.IsNaN(height) {
+		return 0
+	}
+
+	return uint16(math.Max(1, math.Min(math.MaxUint16, math.Round((height-e.Offset)/e.Scale))))
+}
+
+func (e HeightEncoding) metadata() map[string]string {
+	return map[string]string{
+		"ltp:scale":  strconv.FormatFloat(e.Scale, 'g', -1, 64),
+		"ltp:offset": strconv.FormatFloat(e.Offset, 'g', -1, 64),
+		"ltp:nodata": "0",
+		"ltp:unit":   "mm",
+	}
+}
+
+func (e HeightEncoding) description() string {
+	return fmt.Sprintf("ltp height map: height = value * %g + %g mm, value 0 = no data", e.Scale, e.Offset)
+}
+
+// ToGray16 converts the height map into a 16-bit grayscale image, the x-axis
+// are the frames and the y-axis the rows.
+func ToGray16(hm *heightmap.HeightMap, encoding HeightEncoding) *image.Gray16 {
+	img := image.NewGray16(image.Rect(0, 0, hm.Frames(), hm.Rows()))
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			img.SetGray16(frame, row, color.Gray16{Y: encoding.encode(hm.At(frame, row))})
+		}
+	}
+
+	return img
+}
+
+// WritePNG16 writes the height map as 16-bit grayscale PNG. Scale and offset
+// are stored in tEXt chunks.
+func WritePNG16(w io.Writer, hm *heightmap.HeightMap, encoding HeightEncoding) error {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, ToGray16(hm, encoding)); err != nil {
+		return fmt.Errorf("failed to encode png: %w", err)
+	}
+
+	// the text chunks go right after the IHDR chunk (8 byte signature + 25 byte IHDR)
+	encoded := buf.Bytes()
+	const ihdrEnd = 33
+	chunks := &bytes.Buffer{}
+	writePNGTextChunk(chunks, "Description", encoding.description())
+	metadata := encoding.metadata()
+	for _, key := range []string{"ltp:scale", "ltp:offset", "ltp:nodata", "ltp:unit"} {
+		writePNGTextChunk(chunks, key, metadata[key])
+	}
+
+	for _, part := range [][]byte{encoded[:ihdrEnd], chunks.Bytes(), encoded[ihdrEnd:]} {
+		if _, err := w.Write(part); err != nil {
+			return fmt.Errorf("failed to write png: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func writePNGTextChunk(w *bytes.Buffer, key string, value string) {
+	data := append([]byte(key), 0)
+	data = append(data, value...)
+
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	typeAndData := append([]byte("tEXt"), data...)
+	w.Write(typeAndData)
+	binary.Write(w, binary.BigEndian, crc32.ChecksumIEEE(typeAndData))
+}
+
+// WriteTIFF16 writes the height map as uncompressed 16-bit grayscale TIFF.
+// Scale and offset are stored in the ImageDescription tag and in the
+// GDAL_METADATA and GDAL_NODATA tags so GIS tools pick them up.
+func WriteTIFF16(w io.Writer, hm *heightmap.HeightMap, encoding HeightEncoding) error {
+	width := hm.Frames()
+	height := hm.Rows()
+
+	type tiffTag struct {
+		id       uint16
+		datatype uint16 // 2 = ASCII, 3 = SHORT, 4 = LONG, 5 = RATIONAL
+		count    uint32
+		value    []byte // stored inline if it fits into 4 bytes
+	}
+	short := func(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+	long := func(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+	ascii := func(s string) []byte { return append([]byte(s), 0) }
+	rational := func(n, d uint32) []byte { return binary.LittleEndian.AppendUint32(long(n), d) }
+
+	gdalMetadata := fmt.Sprintf("<GDALMetadata>\n  <Item name=\"SCALE\" sample=\"0\" role=\"scale\">%s</Item>\n  <Item name=\"OFFSET\" sample=\"0\" role=\"offset\">%s</Item>\n  <Item name=\"UNITTYPE\" sample=\"0\" role=\"unittype\">mm</Item>\n</GDALMetadata>",
+		strconv.FormatFloat(encoding.Scale, 'g', -1, 64), strconv.FormatFloat(encoding.Offset, 'g', -1, 64))
+
+	const headerSize = 8
+	pixelBytes := uint32(width * height * 2)
+	tags := []tiffTag{
+		{id: 256, datatype: 4, count: 1, value: long(uint32(width))},
+		{id: 257, datatype: 4, count: 1, value: long(uint32(height))},
+		{id: 258, datatype: 3, count: 1, value: short(16)},
+		{id: 259, datatype: 3, count: 1, value: short(1)}, // no compression
+		{id: 262, datatype: 3, count: 1, value: short(1)}, // black is zero
+		{id: 270, datatype: 2, value: ascii(encoding.description())},
+		{id: 273, datatype: 4, count: 1, value: long(headerSize)},
+		{id: 277, datatype: 3, count: 1, value: short(1)},
+		{id: 278, datatype: 4, count: 1, value: long(uint32(height))},
+		{id: 279, datatype: 4, count: 1, value: long(pixelBytes)},
+		{id: 282, datatype: 5, count: 1, value: rational(72, 1)},
+		{id: 283, datatype: 5, count: 1, value: rational(72, 1)},
+		{id: 296, datatype: 3, count: 1, value: short(1)},
+		{id: 42112, datatype: 2, value: ascii(gdalMetadata)},
+		{id: 42113, datatype: 2, value: ascii("0")},
+	}
+
+	// layout: header, pixel data, values that do not fit into a tag, IFD
+	extraOffset := uint32(headerSize) + pixelBytes
+	extra := &bytes.Buffer{}
+	ifd := &bytes.Buffer{}
+	binary.Write(ifd, binary.LittleEndian, uint16(len(tags)))
+	for _, tag := range tags {
+		if tag.datatype == 2 {
+			tag.count = uint32(len(tag.value))
+		}
+		binary.Write(ifd, binary.LittleEndian, tag.id)
+		binary.Write(ifd, binary.LittleEndian, tag.datatype)
+		binary.Write(ifd, binary.LittleEndian, tag.count)
+		if len(tag.value) <= 4 {
+			value := make([]byte, 4)
+			copy(value, tag.value)
+			ifd.Write(value)
+			continue
+		}
+		binary.Write(ifd, binary.LittleEndian, extraOffset+uint32(extra.Len()))
+		extra.Write(tag.value)
+		if extra.Len()%2 == 1 {
+			// values have to start on a word boundary
+			extra.WriteByte(0)
+		}
+	}
+	binary.Write(ifd, binary.LittleEndian, uint32(0)) // no further IFD
+
+	out := &bytes.Buffer{}
+	out.WriteString("II")
+	binary.Write(out, binary.LittleEndian, uint16(42))
+	binary.Write(out, binary.LittleEndian, extraOffset+uint32(extra.Len()))
+	img := ToGray16(hm, encoding)
+	pixels := make([]byte, 0, pixelBytes)
+	for row := range height {
+		for frame := range width {
+			pixels = binary.LittleEndian.AppendUint16(pixels, img.Gray16At(frame, row).Y)
+		}
+	}
+	out.Write(pixels)
+	out.Write(extra.Bytes())
+	out.Write(ifd.Bytes())
+
+	if _, err := w.Write(out.Bytes()); err != nil {
+		return fmt.Errorf("failed to write tiff: %w", err)
+	}
+
+	return nil
+}
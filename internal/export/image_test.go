@@ -0,0 +1,135 @@
+package export
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+func newTestHeightMap(t *testing.T) *heightmap.HeightMap {
+	options := heightmap.NewOptions()
+	options.Rows = 3
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range []map[int]float64{
+		{0: 0, 1: 1, 2: 2},
+		{0: 0.5, 1: -1, 2: 4},
+	} {
+		if err := hm.AddProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return hm
+}
+
+func TestWritePNG16(t *testing.T) {
+	hm := newTestHeightMap(t)
+	encoding := NewHeightEncoding(hm)
+
+	buf := &bytes.Buffer{}
+	if err := WritePNG16(buf, hm, encoding); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("tEXtltp:scale")) {
+		t.Errorf("WritePNG16() did not write the scale into a text chunk")
+	}
+
+	img, err := png.Decode(buf)
+	if err != nil {
+		t.Fatalf("failed to decode png written by WritePNG16(): %v", err)
+	}
+	gray, ok := img.(*image.Gray16)
+	if !ok {
+		t.Fatalf("WritePNG16() wrote %T, want *image.Gray16", img)
+	}
+
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			value := gray.Gray16At(frame, row).Y
+			want := hm.At(frame, row)
+			if math.IsNaN(want) {
+				if value != 0 {
+					t.Errorf("pixel %d,%d = %d, want 0 for no data", frame, row, value)
+				}
+				continue
+			}
+			got := float64(value)*encoding.Scale + encoding.Offset
+			if math.Abs(got-want) > encoding.Scale {
+				t.Errorf("pixel %d,%d decodes to %f, want %f", frame, row, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteTIFF16(t *testing.T) {
+	hm := newTestHeightMap(t)
+
+	buf := &bytes.Buffer{}
+	if err := WriteTIFF16(buf, hm, NewHeightEncoding(hm)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte{'I', 'I', 42, 0}) {
+		t.Errorf("WriteTIFF16() did not write a little-endian tiff header")
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("role=\"scale\"")) {
+		t.Errorf("WriteTIFF16() did not write the GDAL scale metadata")
+	}
+}
+
+func TestRenderFalseColor(t *testing.T) {
+	hm := newTestHeightMap(t)
+
+	img := RenderFalseColor(hm)
+	if img.Bounds().Dx() != hm.Frames()+legendWidth(0, 4) {
+		t.Errorf("RenderFalseColor() width = %d, want %d", img.Bounds().Dx(), hm.Frames()+legendWidth(0, 4))
+	}
+	if img.RGBAAt(0, 0) != FalseColor(0) {
+		t.Errorf("lowest cell has color %v, want %v", img.RGBAAt(0, 0), FalseColor(0))
+	}
+	if img.RGBAAt(1, 2) != FalseColor(1) {
+		t.Errorf("highest cell has color %v, want %v", img.RGBAAt(1, 2), FalseColor(1))
+	}
+	if img.RGBAAt(1, 1) != noDataColor {
+		t.Errorf("cell without data has color %v, want %v", img.RGBAAt(1, 1), noDataColor)
+	}
+}
+
+func TestLegendFitsLabels(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 2
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.AddHeightsAt([]float64{-12.34, 5.5}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	img := RenderFalseColor(hm)
+	// the labels "-12.34 mm" and "5.50 mm" end before the right margin
+	for x := img.Bounds().Dx() - legendMargin; x < img.Bounds().Dx(); x++ {
+		for y := range img.Bounds().Dy() {
+			if img.RGBAAt(x, y) != noDataColor {
+				t.Fatalf("pixel %d,%d of the right margin is drawn, the legend is too narrow", x, y)
+			}
+		}
+	}
+	text := 0
+	for x := img.Bounds().Dx() - legendMargin - textWidth("-12.34 mm"); x < img.Bounds().Dx(); x++ {
+		for y := range img.Bounds().Dy() {
+			if img.RGBAAt(x, y) == legendTextColor {
+				text++
+			}
+		}
+	}
+	if text == 0 {
+		t.Errorf("no label text found in the legend")
+	}
+}
@@ -0,0 +1,87 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// WriteNPY writes the heights as NumPy float32 array with the shape
+// (frames, rows). Cells without a measurement are NaN.
+func WriteNPY(w io.Writer, hm *heightmap.HeightMap) error {
+	bw := bufio.NewWriter(w)
+	if err := writeNPYHeader(bw, "<f4", hm.Frames(), hm.Rows()); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 0, 4*hm.Rows())
+	for frame := range hm.Frames() {
+		buf = buf[:0]
+		for row := range hm.Rows() {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(hm.At(frame, row))))
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return fmt.Errorf("failed to write frame %d: %w", frame, err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteNPYMask writes the mask of valid cells as NumPy bool array with the
+// shape (frames, rows).
+func WriteNPYMask(w io.Writer, hm *heightmap.HeightMap) error {
+	bw := bufio.NewWriter(w)
+	if err := writeNPYHeader(bw, "|b1", hm.Frames(), hm.Rows()); err != nil {
+		return err
+	}
+
+	for _, valid := range hm.Mask() {
+		buf := make([]byte, len(valid))
+		for row, v := range valid {
+			if v {
+				buf[row] = 1
+			}
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return fmt.Errorf("failed to write mask: %w", err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writes the header of a .npy file in version 1.0
+func writeNPYHeader(w io.Writer, descr string, shape ...int) error {
+	dims := make([]string, len(shape))
+	for i, d := range shape {
+		dims[i] = fmt.Sprintf("%d", d)
+	}
+	shapeString := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		shapeString += ","
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, shapeString)
+
+	// magic (6) + version (2) + header length (2) + header has to be a multiple of 64
+	const prefixLength = 10
+	padding := 64 - (prefixLength+len(header)+1)%64
+	if padding == 64 {
+		padding = 0
+	}
+	header += strings.Repeat(" ", padding) + "\n"
+
+	out := []byte("\x93NUMPY\x01\x00")
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(header)))
+	out = append(out, header...)
+	if _, err := w.Write(out); err != nil {
+		return fmt.Errorf("failed to write npy header: %w", err)
+	}
+
+	return nil
+}
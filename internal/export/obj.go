@@ -0,0 +1,28 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/Neokil/ltp/internal/mesh"
+)
+
+// WriteOBJ writes the mesh as Wavefront OBJ file with one normal per vertex.
+func WriteOBJ(w io.Writer, m *mesh.Mesh) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprint(bw, "# generated by ltp, units are mm\n")
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "v %g %g %g\n", v.X, v.Y, v.Z)
+	}
+	for _, n := range m.VertexNormals() {
+		fmt.Fprintf(bw, "vn %g %g %g\n", n.X, n.Y, n.Z)
+	}
+	for _, t := range m.Triangles {
+		// OBJ indices start at 1
+		fmt.Fprintf(bw, "f %d//%d %d//%d %d//%d\n", t[0]+1, t[0]+1, t[1]+1, t[1]+1, t[2]+1, t[2]+1)
+	}
+
+	return bw.Flush()
+}
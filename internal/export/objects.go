@@ -0,0 +1,125 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/measure"
+)
+
+// colors of the objects, repeated if there are more objects
+var objectColors = []color.RGBA{
+	{R: 230, G: 25, B: 75, A: 255},
+	{R: 60, G: 180, B: 75, A: 255},
+	{R: 255, G: 225, B: 25, A: 255},
+	{R: 0, G: 130, B: 200, A: 255},
+	{R: 245, G: 130, B: 48, A: 255},
+	{R: 145, G: 30, B: 180, A: 255},
+	{R: 70, G: 240, B: 240, A: 255},
+	{R: 240, G: 50, B: 230, A: 255},
+}
+
+// RenderObjects renders the height map in gray with every object tinted in its
+// own color, its oriented bounding box drawn as outline and its ID written at
+// the centroid. Like RenderFalseColor the x-axis are the frames and the y-axis
+// the rows.
+func RenderObjects(hm *heightmap.HeightMap, seg measure.Segmentation) *image.RGBA {
+	lo, hi, ok := hm.Range()
+	if !ok {
+		lo, hi = 0, 0
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, hm.Frames(), hm.Rows()))
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			h := hm.At(frame, row)
+			if math.IsNaN(h) {
+				img.SetRGBA(frame, row, noDataColor)
+				continue
+			}
+			value := 0.0
+			if hi > lo {
+				value = (h - lo) / (hi - lo)
+			}
+			gray := uint8(64 + math.Round(value*191))
+			c := color.RGBA{R: gray, G: gray, B: gray, A: 255}
+			if id := seg.Labels[frame][row]; id > 0 {
+				c = tint(c, objectColors[(id-1)%len(objectColors)])
+			}
+			img.SetRGBA(frame, row, c)
+		}
+	}
+
+	for _, obj := range seg.Objects {
+		corners := obj.OrientedBoundingBox.Corners
+		for i := range corners {
+			x0, y0 := toPixel(hm, corners[i])
+			x1, y1 := toPixel(hm, corners[(i+1)%len(corners)])
+			drawLine(img, x0, y0, x1, y1, legendTextColor)
+		}
+		x, y := toPixel(hm, obj.Centroid)
+		label := strconv.Itoa(obj.ID)
+		drawText(img, int(math.Round(x))-len(label)*(glyphWidth+1)*glyphScale/2, int(math.Round(y))-glyphHeight*glyphScale/2, label)
+	}
+
+	return img
+}
+
+// WriteObjectsPNG writes the annotated rendering of the objects as PNG.
+func WriteObjectsPNG(w io.Writer, hm *heightmap.HeightMap, seg measure.Segmentation) error {
+	if err := png.Encode(w, RenderObjects(hm, seg)); err != nil {
+		return fmt.Errorf("failed to encode png: %w", err)
+	}
+
+	return nil
+}
+
+func tint(c color.RGBA, t color.RGBA) color.RGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8((int(a) + 2*int(b)) / 3)
+	}
+
+	return color.RGBA{R: mix(c.R, t.R), G: mix(c.G, t.G), B: mix(c.B, t.B), A: 255}
+}
+
+// converts a position in mm into pixel coordinates, frames do not need to be
+// evenly spaced so the frame is interpolated between its neighbours
+func toPixel(hm *heightmap.HeightMap, p measure.Point) (float64, float64) {
+	y := 0.0
+	if hm.RowSpacing != 0 {
+		y = (p.Y - hm.RowOffset) / hm.RowSpacing
+	}
+
+	positions := hm.FramePositions
+	if len(positions) < 2 {
+		return 0, y
+	}
+	for i := 0; i < len(positions)-1; i++ {
+		a, b := positions[i], positions[i+1]
+		if (p.X >= math.Min(a, b) && p.X <= math.Max(a, b)) || i == len(positions)-2 {
+			if a == b {
+				return float64(i), y
+			}
+			return float64(i) + (p.X-a)/(b-a), y
+		}
+	}
+
+	return 0, y
+}
+
+func drawLine(img *image.RGBA, x0 float64, y0 float64, x1 float64, y1 float64, c color.RGBA) {
+	steps := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))))
+	for i := 0; i <= steps; i++ {
+		f := 0.0
+		if steps > 0 {
+			f = float64(i) / float64(steps)
+		}
+		img.SetRGBA(int(math.Round(x0+f*(x1-x0))), int(math.Round(y0+f*(y1-y0))), c)
+	}
+}
@@ -0,0 +1,116 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Neokil/ltp/internal/pointcloud"
+)
+
+type PLYFormat string
+
+const (
+	PLYASCII              PLYFormat = "ascii"
+	PLYBinaryLittleEndian PLYFormat = "binary_little_endian"
+)
+
+type PLYOptions struct {
+	Format     PLYFormat
+	Color      bool // write red, green and blue per vertex, requires a point cloud with colors
+	Confidence bool // write a confidence property per vertex
+}
+
+func NewPLYOptions() PLYOptions {
+	return PLYOptions{
+		Format:     PLYBinaryLittleEndian,
+		Color:      false,
+		Confidence: true,
+	}
+}
+
+func (o PLYOptions) Validate() error {
+	if o.Format != PLYASCII && o.Format != PLYBinaryLittleEndian {
+		return fmt.Errorf("PLY-Format \"%s\" is invalid. Valid Values are: %s, %s", o.Format, PLYASCII, PLYBinaryLittleEndian)
+	}
+
+	return nil
+}
+
+// WritePLY writes the point cloud as PLY file that can be loaded by
+// CloudCompare or MeshLab.
+func WritePLY(w io.Writer, pc *pointcloud.PointCloud, options PLYOptions) error {
+	if err := options.Validate(); err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+	if options.Color && !pc.HasColor {
+		return fmt.Errorf("colors were requested but the point cloud has no colors")
+	}
+
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "ply\nformat %s 1.0\ncomment generated by ltp, units are mm\n", options.Format)
+	fmt.Fprintf(bw, "element vertex %d\n", len(pc.Points))
+	fmt.Fprint(bw, "property float x\nproperty float y\nproperty float z\n")
+	if options.Color {
+		fmt.Fprint(bw, "property uchar red\nproperty uchar green\nproperty uchar blue\n")
+	}
+	if options.Confidence {
+		fmt.Fprint(bw, "property float confidence\n")
+	}
+	fmt.Fprint(bw, "end_header\n")
+
+	for _, p := range pc.Points {
+		var err error
+		if options.Format == PLYASCII {
+			err = writePLYVertexASCII(bw, p, options)
+		} else {
+			err = writePLYVertexBinary(bw, p, options)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write vertex: %w", err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writePLYVertexASCII(w io.Writer, p pointcloud.Point, options PLYOptions) error {
+	_, err := fmt.Fprintf(w, "%g %g %g", float32(p.X), float32(p.Y), float32(p.Z))
+	if err != nil {
+		return err
+	}
+	if options.Color {
+		_, err = fmt.Fprintf(w, " %d %d %d", p.Color.R, p.Color.G, p.Color.B)
+		if err != nil {
+			return err
+		}
+	}
+	if options.Confidence {
+		_, err = fmt.Fprintf(w, " %g", float32(p.Confidence))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprint(w, "\n")
+
+	return err
+}
+
+func writePLYVertexBinary(w io.Writer, p pointcloud.Point, options PLYOptions) error {
+	buf := make([]byte, 0, 19)
+	buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(p.X)))
+	buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(p.Y)))
+	buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(p.Z)))
+	if options.Color {
+		buf = append(buf, p.Color.R, p.Color.G, p.Color.B)
+	}
+	if options.Confidence {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(p.Confidence)))
+	}
+	_, err := w.Write(buf)
+
+	return err
+}
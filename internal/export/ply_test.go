@@ -0,0 +1,83 @@
+package export
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/pointcloud"
+)
+
+func TestWritePLY(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 3
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.AddProfile(map[int]float64{0: 0, 1: -1, 2: 2.5}); err != nil {
+		t.Fatal(err)
+	}
+	pc := pointcloud.FromHeightMap(hm)
+
+	tests := []struct {
+		name    string
+		pc      *pointcloud.PointCloud
+		options PLYOptions
+		want    string
+		wantLen int
+		wantErr bool
+	}{
+		{
+			name:    "ascii with confidence skips invalid rows",
+			pc:      pc,
+			options: PLYOptions{Format: PLYASCII, Confidence: true},
+			want: "ply\nformat ascii 1.0\ncomment generated by ltp, units are mm\nelement vertex 2\n" +
+				"property float x\nproperty float y\nproperty float z\nproperty float confidence\nend_header\n" +
+				"0 0 0 1\n0 2 2.5 1\n",
+		},
+		{
+			name: "ascii with colors",
+			pc: &pointcloud.PointCloud{
+				Points:   []pointcloud.Point{{X: 1, Y: 2, Z: 3, Color: color.RGBA{R: 255, G: 128, B: 0, A: 255}}},
+				HasColor: true,
+			},
+			options: PLYOptions{Format: PLYASCII, Color: true},
+			want: "ply\nformat ascii 1.0\ncomment generated by ltp, units are mm\nelement vertex 1\n" +
+				"property float x\nproperty float y\nproperty float z\nproperty uchar red\nproperty uchar green\nproperty uchar blue\nend_header\n" +
+				"1 2 3 255 128 0\n",
+		},
+		{
+			name:    "binary has 16 bytes per vertex with confidence",
+			pc:      pc,
+			options: PLYOptions{Format: PLYBinaryLittleEndian, Confidence: true},
+			wantLen: 2 * 16,
+		},
+		{
+			name:    "colors without colored point cloud",
+			pc:      pc,
+			options: PLYOptions{Format: PLYASCII, Color: true},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			err := WritePLY(buf, tt.pc, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WritePLY() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.want != "" && buf.String() != tt.want {
+				t.Errorf("WritePLY() = %q, want %q", buf.String(), tt.want)
+			}
+			if tt.wantLen > 0 {
+				body := buf.Bytes()[bytes.Index(buf.Bytes(), []byte("end_header\n"))+len("end_header\n"):]
+				if len(body) != tt.wantLen {
+					t.Errorf("WritePLY() body has %d bytes, want %d", len(body), tt.wantLen)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Neokil/ltp/internal/mesh"
+)
+
+type STLFormat string
+
+const (
+	STLASCII  STLFormat = "ascii"
+	STLBinary STLFormat = "binary"
+)
+
+// WriteSTL writes the mesh as STL file with one normal per triangle.
+func WriteSTL(w io.Writer, m *mesh.Mesh, format STLFormat) error {
+	switch format {
+	case STLASCII:
+		return writeSTLASCII(w, m)
+	case STLBinary:
+		return writeSTLBinary(w, m)
+	}
+
+	return fmt.Errorf("STL-Format \"%s\" is invalid. Valid Values are: %s, %s", format, STLASCII, STLBinary)
+}
+
+func writeSTLASCII(w io.Writer, m *mesh.Mesh) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprint(bw, "solid ltp\n")
+	for i, t := range m.Triangles {
+		n := m.Normal(i)
+		fmt.Fprintf(bw, "  facet normal %g %g %g\n    outer loop\n", n.X, n.Y, n.Z)
+		for _, v := range t {
+			p := m.Vertices[v]
+			fmt.Fprintf(bw, "      vertex %g %g %g\n", p.X, p.Y, p.Z)
+		}
+		fmt.Fprint(bw, "    endloop\n  endfacet\n")
+	}
+	fmt.Fprint(bw, "endsolid ltp\n")
+
+	return bw.Flush()
+}
+
+func writeSTLBinary(w io.Writer, m *mesh.Mesh) error {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 80)
+	copy(header, "ltp height map mesh, units are mm")
+	if _, err := bw.Write(header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint32(len(m.Triangles))); err != nil {
+		return fmt.Errorf("failed to write triangle count: %w", err)
+	}
+
+	buf := make([]byte, 0, 50)
+	for i, t := range m.Triangles {
+		buf = buf[:0]
+		for _, v := range []mesh.Vec3{m.Normal(i), m.Vertices[t[0]], m.Vertices[t[1]], m.Vertices[t[2]]} {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(v.X)))
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(v.Y)))
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(v.Z)))
+		}
+		buf = append(buf, 0, 0) // attribute byte count
+		if _, err := bw.Write(buf); err != nil {
+			return fmt.Errorf("failed to write triangle %d: %w", i, err)
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Neokil/ltp/internal/pointcloud"
+)
+
+// WriteProfilesCSV writes one record per row and frame with the positions of
+// all lines, the height, the lateral position, the status and the indices of
+// the calibrated lines the height was calculated from. The number of line
+// columns is the highest number of lines found in any row, missing lines are
+// left empty. The frame is the index of the camera frame, in the multi-line
+// mode the profiles of all lines of a camera frame share it.
+func WriteProfilesCSV(w io.Writer, frames []pointcloud.Frame) error {
+	lineColumns := 0
+	for _, frame := range frames {
+		for _, row := range frame.Profile.Rows {
+			lineColumns = max(lineColumns, len(row.Throughs))
+		}
+	}
+
+	cw := csv.NewWriter(w)
+
+	header := []string{"frame", "position_mm", "row", "line_count"}
+	for i := range lineColumns {
+		header = append(header, fmt.Sprintf("line%d_x", i+1))
+	}
+	header = append(header, "height_mm", "lateral_mm", "status", "confidence", "lines")
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	for i, frame := range frames {
+		for _, row := range frame.Profile.Rows {
+			record := []string{
+				strconv.Itoa(frame.Index),
+				formatFloat(frame.Position),
+				strconv.Itoa(row.Row),
+				strconv.Itoa(len(row.Throughs)),
+			}
+			for line := range lineColumns {
+				if line < len(row.Throughs) {
+					record = append(record, strconv.Itoa(row.Throughs[line]))
+				} else {
+					record = append(record, "")
+				}
+			}
+			height, lateral := "", ""
+			if row.Status.Valid() {
+				height = formatFloat(row.Height)
+				lateral = formatFloat(row.Lateral)
+			}
+			lines := make([]string, len(row.Lines))
+			for j, line := range row.Lines {
+				lines[j] = strconv.Itoa(line)
+			}
+			record = append(record, height, lateral, row.Status.String(), formatFloat(row.Confidence), strings.Join(lines, " "))
+
+			if err := cw.Write(record); err != nil {
+				return fmt.Errorf("failed to write frame %d row %d: %w", i, row.Row, err)
+			}
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// WriteXYZ writes the point cloud as plain "x y z" lines in mm.
+func WriteXYZ(w io.Writer, pc *pointcloud.PointCloud) error {
+	bw := bufio.NewWriter(w)
+	for _, p := range pc.Points {
+		if _, err := fmt.Fprintf(bw, "%s %s %s\n", formatFloat(p.X), formatFloat(p.Y), formatFloat(p.Z)); err != nil {
+			return fmt.Errorf("failed to write point: %w", err)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
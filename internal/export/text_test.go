@@ -0,0 +1,89 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+	"github.com/Neokil/ltp/internal/pointcloud"
+)
+
+func TestWriteProfilesCSV(t *testing.T) {
+	frames := []pointcloud.Frame{
+		{
+			Position: 0.5,
+			Profile: frameprocessor.Profile{Rows: []frameprocessor.RowResult{
+				{Row: 0, Throughs: []int{3}, Height: 0, Status: frameprocessor.StatusGround, Confidence: 1, Lines: []int{0, 1}},
+				{Row: 1, Throughs: []int{2, 4}, Height: 2, Status: frameprocessor.StatusMeasured, Confidence: 0.5, Lines: []int{0, 1}, Lateral: -0.5},
+				{Row: 2, Throughs: []int{6}, Height: 1.5, Status: frameprocessor.StatusMeasured, Confidence: 1, Lines: []int{1}},
+				{Row: 3, Throughs: []int{}, Height: -1, Status: frameprocessor.StatusInvalid},
+			}},
+		},
+		{
+			// the second line of the same camera frame in the multi-line mode
+			Position: 2.5,
+			Profile: frameprocessor.Profile{Rows: []frameprocessor.RowResult{
+				{Row: 0, Throughs: []int{7}, Height: 1, Status: frameprocessor.StatusMeasured, Confidence: 1, Lines: []int{1}},
+			}},
+		},
+		{
+			Index:    1,
+			Position: 1.5,
+			Profile: frameprocessor.Profile{Rows: []frameprocessor.RowResult{
+				{Row: 0, Throughs: []int{3}, Height: 0, Status: frameprocessor.StatusGround, Confidence: 1, Lines: []int{0}},
+			}},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteProfilesCSV(buf, frames); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "frame,position_mm,row,line_count,line1_x,line2_x,height_mm,lateral_mm,status,confidence,lines\n" +
+		"0,0.5,0,1,3,,0,0,ground,1,0 1\n" +
+		"0,0.5,1,2,2,4,2,-0.5,measured,0.5,0 1\n" +
+		"0,0.5,2,1,6,,1.5,0,measured,1,1\n" +
+		"0,0.5,3,0,,,,,invalid,0,\n" +
+		"0,2.5,0,1,7,,1,0,measured,1,1\n" +
+		"1,1.5,0,1,3,,0,0,ground,1,0\n"
+	if buf.String() != want {
+		t.Errorf("WriteProfilesCSV() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteNPY(t *testing.T) {
+	hm := newTestHeightMap(t)
+
+	buf := &bytes.Buffer{}
+	if err := WriteNPY(buf, hm); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) {
+		t.Fatalf("WriteNPY() did not write the npy magic")
+	}
+	headerLength := int(binary.LittleEndian.Uint16(data[8:10]))
+	if (10+headerLength)%64 != 0 {
+		t.Errorf("npy header ends at %d, want a multiple of 64", 10+headerLength)
+	}
+	header := string(data[10 : 10+headerLength])
+	if !bytes.Contains([]byte(header), []byte("'shape': (2, 3)")) {
+		t.Errorf("npy header = %q, want shape (2, 3)", header)
+	}
+
+	values := data[10+headerLength:]
+	if len(values) != 2*3*4 {
+		t.Fatalf("npy has %d bytes of data, want %d", len(values), 2*3*4)
+	}
+	// frame 1 row 1 has no measurement
+	if v := math.Float32frombits(binary.LittleEndian.Uint32(values[4*4:])); !math.IsNaN(float64(v)) {
+		t.Errorf("frame 1 row 1 = %f, want NaN", v)
+	}
+	if v := math.Float32frombits(binary.LittleEndian.Uint32(values[5*4:])); v != 4 {
+		t.Errorf("frame 1 row 2 = %f, want 4", v)
+	}
+}
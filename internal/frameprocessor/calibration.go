@@ -0,0 +1,86 @@
+package frameprocessor
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+)
+
+// CalibrateSingleLine calibrates a laser line from an image of the empty plate
+// and an image of a gauge block with the given height in mm, both with only
+// this line turned on. The baseline is the position of the line on the plate
+// in every row, the shift per mm is the median shift of the rows the block
+// covers.
+func CalibrateSingleLine(plate image.Image, block image.Image, blockHeight float64, options ProcessorOptions) (LineCalibration, error) {
+	lines, err := CalibrateLines(plate, block, blockHeight, 1, options)
+	if err != nil {
+		return LineCalibration{}, err
+	}
+
+	return lines[0], nil
+}
+
+// CalibrateLines works like CalibrateSingleLine for n parallel lines of a
+// projector that are turned on together. The throughs are assigned to the
+// lines by their order, so only rows with exactly n throughs are used.
+func CalibrateLines(plate image.Image, block image.Image, blockHeight float64, n int, options ProcessorOptions) ([]LineCalibration, error) {
+	if blockHeight == 0 {
+		return nil, fmt.Errorf("the height of the gauge block can not be 0")
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("at least 1 line is needed but got %d", n)
+	}
+	options.Mode = ModeDualLine
+	options.CalibrationResults.Lines = nil
+
+	plateProfile, err := DetermineProfile(plate, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process plate image: %w", err)
+	}
+	blockProfile, err := DetermineProfile(block, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process gauge block image: %w", err)
+	}
+
+	lines := make([]LineCalibration, n)
+	for i := range lines {
+		lines[i].Baseline = make([]float64, len(plateProfile.Rows))
+		for j, row := range plateProfile.Rows {
+			lines[i].Baseline[j] = -1
+			if len(row.Throughs) == n {
+				lines[i].Baseline[j] = float64(row.Throughs[i])
+			}
+		}
+	}
+
+	shifts := make([][]float64, n)
+	for _, row := range blockProfile.Rows {
+		if len(row.Throughs) != n || row.Row >= len(plateProfile.Rows) {
+			continue
+		}
+		for i, x := range row.Throughs {
+			if lines[i].Baseline[row.Row] < 0 {
+				continue
+			}
+			shift := float64(x) - lines[i].Baseline[row.Row]
+			// rows the block does not cover still show the line on the plate
+			if math.Abs(shift) < 1 {
+				continue
+			}
+			shifts[i] = append(shifts[i], shift/blockHeight)
+		}
+	}
+	for i := range lines {
+		if len(shifts[i]) == 0 {
+			if n == 1 {
+				return nil, fmt.Errorf("the line is not shifted in any row, the gauge block needs to be in the laser line")
+			}
+			return nil, fmt.Errorf("line %d is not shifted in any row, the gauge block needs to be in all laser lines", i)
+		}
+		sort.Float64s(shifts[i])
+		lines[i].ShiftPerMM = shifts[i][len(shifts[i])/2]
+	}
+
+	return lines, nil
+}
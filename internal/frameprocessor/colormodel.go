@@ -0,0 +1,157 @@
+package frameprocessor
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// ColorModel is the distribution of the colors a laser is seen with, in 8 bit
+// RGB. Real lasers are often orange-white in the center of the line and dark
+// red at its edges, which a single color does not describe.
+type ColorModel struct {
+	Mean       [3]float64    `json:"mean"`
+	Covariance [3][3]float64 `json:"covariance"`
+}
+
+// Color returns the mean color of the model, e.g. to be used as Lasercolor
+func (cm ColorModel) Color() color.RGBA {
+	c := color.RGBA{A: 255}
+	for i, v := range []*uint8{&c.R, &c.G, &c.B} {
+		*v = uint8(math.Round(math.Max(0, math.Min(255, cm.Mean[i]))))
+	}
+
+	return c
+}
+
+type EstimateOptions struct {
+	MinSaturation float64 // 0 to 1, pixels with a less saturated hue are no candidates for the laser
+	Fraction      float64 // share of the candidates that is used, starting with the brightest
+	MinSamples    int     // the estimation fails with less pixels
+}
+
+func NewEstimateOptions() EstimateOptions {
+	return EstimateOptions{
+		MinSaturation: 0.3,
+		Fraction:      0.01,
+		MinSamples:    10,
+	}
+}
+
+func (eo EstimateOptions) Validate() error {
+	if eo.MinSaturation < 0 || eo.MinSaturation > 1 {
+		return fmt.Errorf("MinSaturation needs to be between 0 and 1")
+	}
+	if eo.Fraction <= 0 || eo.Fraction > 1 {
+		return fmt.Errorf("Fraction needs to be greater than 0 and at most 1")
+	}
+	if eo.MinSamples < 1 {
+		return fmt.Errorf("MinSamples needs to be at least 1")
+	}
+
+	return nil
+}
+
+// EstimateColorModel fits the color distribution of the laser to the
+// brightest pixels with a saturated hue of the sample frames.
+func EstimateColorModel(frames []image.Image, options EstimateOptions) (ColorModel, error) {
+	if err := options.Validate(); err != nil {
+		return ColorModel{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	type candidate struct {
+		rgb        [3]float64
+		brightness float64
+	}
+	candidates := []candidate{}
+	for _, img := range frames {
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				rgb := [3]float64{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+				brightness := math.Max(rgb[0], math.Max(rgb[1], rgb[2]))
+				darkest := math.Min(rgb[0], math.Min(rgb[1], rgb[2]))
+				if brightness == 0 || (brightness-darkest)/brightness < options.MinSaturation {
+					continue
+				}
+				candidates = append(candidates, candidate{rgb: rgb, brightness: brightness})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].brightness > candidates[j].brightness })
+	n := int(math.Ceil(float64(len(candidates)) * options.Fraction))
+	if n < options.MinSamples {
+		return ColorModel{}, fmt.Errorf("found %d laser pixels but need at least %d", n, options.MinSamples)
+	}
+
+	cm := ColorModel{}
+	for _, c := range candidates[:n] {
+		for i := range 3 {
+			cm.Mean[i] += c.rgb[i] / float64(n)
+		}
+	}
+	for _, c := range candidates[:n] {
+		for i := range 3 {
+			for j := range 3 {
+				cm.Covariance[i][j] += (c.rgb[i] - cm.Mean[i]) * (c.rgb[j] - cm.Mean[j]) / float64(n)
+			}
+		}
+	}
+	// channels that are the same in every sample, e.g. saturated ones, would
+	// make the covariance singular
+	for i := range 3 {
+		cm.Covariance[i][i]++
+	}
+
+	return cm, nil
+}
+
+// mahalanobis measures the distance of colors to a color model in standard
+// deviations
+type mahalanobis struct {
+	mean    [3]float64
+	inverse [3][3]float64
+}
+
+func newMahalanobis(cm ColorModel) (mahalanobis, error) {
+	c := cm.Covariance
+	cofactor := [3][3]float64{}
+	for i := range 3 {
+		for j := range 3 {
+			a, b := c[(i+1)%3], c[(i+2)%3]
+			cofactor[i][j] = a[(j+1)%3]*b[(j+2)%3] - a[(j+2)%3]*b[(j+1)%3]
+		}
+	}
+	det := c[0][0]*cofactor[0][0] + c[0][1]*cofactor[0][1] + c[0][2]*cofactor[0][2]
+	if math.Abs(det) < 1e-12 {
+		return mahalanobis{}, fmt.Errorf("the covariance of the color model is singular")
+	}
+
+	m := mahalanobis{mean: cm.Mean}
+	for i := range 3 {
+		for j := range 3 {
+			m.inverse[i][j] = cofactor[j][i] / det
+		}
+	}
+
+	return m, nil
+}
+
+// distance returns the Mahalanobis distance scaled by 1000 per standard
+// deviation, so a MaxColorDeviation of 3000 accepts colors within 3 standard
+// deviations of the model
+func (m mahalanobis) distance(pixel color.Color) (uint16, error) {
+	r, g, b, _ := pixel.RGBA()
+	d := [3]float64{float64(r>>8) - m.mean[0], float64(g>>8) - m.mean[1], float64(b>>8) - m.mean[2]}
+	sum := 0.0
+	for i := range 3 {
+		for j := range 3 {
+			sum += d[i] * m.inverse[i][j] * d[j]
+		}
+	}
+
+	return uint16(math.Min(math.MaxUint16, 1000*math.Sqrt(math.Max(0, sum)))), nil
+}
@@ -8,6 +8,7 @@ import (
 	"image/jpeg"
 	"math"
 	"os"
+	"sort"
 
 	"github.com/Neokil/go-ext/pkg/slice"
 )
@@ -17,21 +18,72 @@ type Tuple[K, V any] struct {
 	V2 V
 }
 
+// Mode selects how the height of a row is calculated from its throughs
+type Mode string
+
+const (
+	ModeDualLine   Mode = "dual-line"   // two laser lines that meet at the plate, the height is their distance
+	ModeSingleLine Mode = "single-line" // one laser line, the height is its shift against the calibrated baseline
+	ModeMultiLine  Mode = "multi-line"  // several parallel projector lines, each measured like the single-line mode
+)
+
+// Detection selects how the pixels of the laser lines are found
+type Detection string
+
+const (
+	DetectionColor     Detection = "color"     // pixels close to the laser color
+	DetectionIntensity Detection = "intensity" // the brightest pixels, for monochrome cameras and IR lasers behind a band-pass filter
+)
+
 type ProcessorOptions struct {
-	LineDirection      string // currently only horizontal is supported
+	LineDirection      string    // currently only horizontal is supported
+	Mode               Mode      // empty is the dual-line mode
+	Detection          Detection // empty is the color detection
 	Lasercolor         color.Color
 	MaxColorDeviation  uint16
+	Lasers             []Laser     // lasers that are told apart by their color, replaces Lasercolor and MaxColorDeviation if set
+	ColorModel         *ColorModel // learned colors of the laser, replaces the distance to Lasercolor by the Mahalanobis distance to the model if set
 	MinThroughWidth    int
 	MinThroughHeight   uint16
+	MaxLineShift       float64 // multi-line mode: pixels a line may move between two rows to still be tracked
+	MinIntensity       uint16  // intensity detection: darker pixels are ignored, 16 bit gray
+	MinPeakHeight      uint16  // intensity detection: how much brighter a peak has to be than the pixels next to it, 16 bit gray
 	CalibrationResults CalibrationResults
 	Debug              DebugOptions
 }
 
+// Laser is the color of a laser line and how far pixels may deviate from it
+type Laser struct {
+	Color             color.Color
+	MaxColorDeviation uint16
+}
+
 type CalibrationResults struct {
 	DistanceAt0  float64 // distance of laser lines at the plate (should be 0)
 	DistanceAt10 float64 // distance of laser lines 10mm above the plate (the further apart, the better the height-calculation, but the smaller the resolution)
 	WidthOfLaser float64 // thickness of the laser-line
 	PixelPerMM   float64 // how many pixels represent one mm
+
+	LateralOrigin float64 // column in pixel of lateral position 0, negative for the center of the frame
+
+	Lines []LineCalibration // calibration of every laser line, needed by the single-line and multi-line modes and used by the dual-line mode to recover rows where one line is hidden
+}
+
+// LineCalibration describes where a laser line is seen on the plate and how it
+// moves with the height of the object.
+type LineCalibration struct {
+	Baseline   []float64 `json:"baseline"`     // x-position of the line on the plate in pixel per row, negative for rows without a baseline
+	ShiftPerMM float64   `json:"shift_per_mm"` // pixels the line moves per mm of height, negative if it moves to the left
+}
+
+// HeightAt returns the height of the line seen at x in the given row. ok is
+// false if the row has no baseline.
+func (lc LineCalibration) HeightAt(row int, x float64) (float64, bool) {
+	if row < 0 || row >= len(lc.Baseline) || lc.Baseline[row] < 0 || lc.ShiftPerMM == 0 {
+		return 0, false
+	}
+
+	return (x - lc.Baseline[row]) / lc.ShiftPerMM, true
 }
 
 type DebugOptions struct {
@@ -42,11 +94,15 @@ type DebugOptions struct {
 func NewProcessorOptions() ProcessorOptions {
 	return ProcessorOptions{
 		LineDirection:      "horizontal",
+		Mode:               ModeDualLine,
 		Lasercolor:         color.RGBA{R: 255, G: 0, B: 0, A: 255},
 		MaxColorDeviation:  10000,
 		MinThroughWidth:    15,
 		MinThroughHeight:   1, // need to find a good default. Indicates how clear the line has to be to be recognized, should be more than the normal variance of colors
-		CalibrationResults: CalibrationResults{},
+		MaxLineShift:       5,
+		MinIntensity:       0x4000,
+		MinPeakHeight:      0x800,
+		CalibrationResults: CalibrationResults{LateralOrigin: -1},
 	}
 }
 
@@ -54,10 +110,73 @@ func (po ProcessorOptions) Validate() error {
 	if po.LineDirection != "horizontal" {
 		return fmt.Errorf("Line-Direction \"%s\" is invalid. Valid Values are: horizontal", po.LineDirection)
 	}
+	switch po.Detection {
+	case "", DetectionColor:
+	case DetectionIntensity:
+		if len(po.Lasers) > 1 {
+			return fmt.Errorf("the intensity detection can not tell %d lasers apart", len(po.Lasers))
+		}
+	default:
+		return fmt.Errorf("Detection \"%s\" is invalid. Valid Values are: %s, %s", po.Detection, DetectionColor, DetectionIntensity)
+	}
+	if po.ColorModel != nil {
+		if po.Detection == DetectionIntensity || len(po.Lasers) > 1 {
+			return fmt.Errorf("the color model can only be used for a single laser with the color detection")
+		}
+		if _, err := newMahalanobis(*po.ColorModel); err != nil {
+			return err
+		}
+	}
+	if len(po.Lasers) > 1 && (po.Mode == ModeSingleLine || po.Mode == ModeMultiLine || len(po.Lasers) != 2) {
+		return fmt.Errorf("several laser colors are only supported for the two lines of the dual-line mode but got %d", len(po.Lasers))
+	}
+	switch po.Mode {
+	case "", ModeDualLine:
+		if n := len(po.CalibrationResults.Lines); n != 0 && n != 2 {
+			return fmt.Errorf("the dual-line mode needs the calibration of 0 or 2 lines but got %d", n)
+		}
+	case ModeSingleLine:
+		if len(po.CalibrationResults.Lines) != 1 {
+			return fmt.Errorf("the single-line mode needs the calibration of exactly 1 line but got %d", len(po.CalibrationResults.Lines))
+		}
+		if po.CalibrationResults.Lines[0].ShiftPerMM == 0 {
+			return fmt.Errorf("ShiftPerMM of the line calibration can not be 0")
+		}
+	case ModeMultiLine:
+		if len(po.CalibrationResults.Lines) < 2 {
+			return fmt.Errorf("the multi-line mode needs the calibration of at least 2 lines but got %d", len(po.CalibrationResults.Lines))
+		}
+		for i, line := range po.CalibrationResults.Lines {
+			if line.ShiftPerMM == 0 {
+				return fmt.Errorf("ShiftPerMM of the calibration of line %d can not be 0", i)
+			}
+		}
+		if po.MaxLineShift <= 0 {
+			return fmt.Errorf("MaxLineShift needs to be greater than 0")
+		}
+	default:
+		return fmt.Errorf("Mode \"%s\" is invalid. Valid Values are: %s, %s, %s", po.Mode, ModeDualLine, ModeSingleLine, ModeMultiLine)
+	}
 
 	return nil
 }
 
+// returns the lasers to look for, the Lasercolor if no lasers are set
+func (po ProcessorOptions) lasers() []Laser {
+	if len(po.Lasers) > 0 {
+		return po.Lasers
+	}
+
+	return []Laser{{Color: po.Lasercolor, MaxColorDeviation: po.MaxColorDeviation}}
+}
+
+// invertedIntensity is the distance of the intensity detection. The brightest
+// pixels are the closest to the laser, so the throughs are the brightness
+// peaks. 8 and 16 bit gray frames keep their full resolution.
+func invertedIntensity(pixel color.Color) (uint16, error) {
+	return math.MaxUint16 - color.Gray16Model.Convert(pixel).(color.Gray16).Y, nil
+}
+
 func ColorDistanceSimpleEuclidean(color1 color.Color, color2 color.Color) (uint16, error) {
 	r1, g1, b1, _ := color1.RGBA()
 	r2, g2, b2, _ := color2.RGBA()
@@ -98,13 +217,111 @@ func ColorDistanceRedman(color1 color.Color, color2 color.Color) (uint16, error)
 	return uint16(dist * 65535 / 675), nil
 }
 
+// Status describes how the height of a row was determined
+type Status int
+
+const (
+	StatusInvalid    Status = iota // no or too many throughs, the row has no valid measurement
+	StatusGround                   // a single through, the lines meet at the plate
+	StatusMeasured                 // the height is calculated from the throughs
+	StatusUnresolved               // multi-line mode: the throughs could not be assigned to the lines without ambiguity
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusGround:
+		return "ground"
+	case StatusMeasured:
+		return "measured"
+	case StatusUnresolved:
+		return "unresolved"
+	}
+
+	return "invalid"
+}
+
+// Valid reports whether a row with this status has a height
+func (s Status) Valid() bool {
+	return s == StatusGround || s == StatusMeasured
+}
+
+// RowResult is the measurement of a single row of the frame
+type RowResult struct {
+	Row        int
+	Throughs   []int   // x-positions of the throughs in pixel
+	Labels     []int   // laser of every through if several lasers are set, nil otherwise
+	Height     float64 // height in mm, -1 if the row has no valid measurement. In the single-line mode valid heights may be negative too, the Status tells them apart
+	Status     Status
+	Confidence float64 // 0 to 1, how close the throughs are to the laser color
+	Lines      []int   // indices of the laser lines the height was calculated from, empty for invalid rows
+	Lateral    float64 // position across the frame in mm of the midpoint of the throughs, relative to the LateralOrigin, 0 for invalid rows
+}
+
+// Profile is the measurement of all rows of a frame
+type Profile struct {
+	Rows   []RowResult
+	Offset float64 // multi-line mode: position of the line across the frame in mm relative to the LateralOrigin, the lateral positions of the rows are relative to it
+}
+
+// Heights returns the height per row in the format of DetermineHeightPerLine.
+// Negative heights of the single-line mode can not be told apart from invalid
+// rows in this format.
+func (p Profile) Heights() map[int]float64 {
+	result := map[int]float64{}
+	for _, row := range p.Rows {
+		result[row.Row] = row.Height
+	}
+
+	return result
+}
+
 func DetermineHeightPerLine(img image.Image, options ProcessorOptions) (map[int]float64, error) {
+	profile, err := DetermineProfile(img, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return profile.Heights(), nil
+}
+
+// DetermineProfile works like DetermineHeightPerLine but keeps the positions
+// of the throughs, the status and the confidence of every row.
+func DetermineProfile(img image.Image, options ProcessorOptions) (Profile, error) {
+	if options.Mode == ModeMultiLine {
+		return Profile{}, fmt.Errorf("the multi-line mode has a profile per line, use DetermineLineProfiles")
+	}
+	profiles, err := DetermineLineProfiles(img, options)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	return profiles[0], nil
+}
+
+// DetermineLineProfiles returns a profile per calibrated line in the
+// multi-line mode and the single profile of DetermineProfile in the other
+// modes.
+func DetermineLineProfiles(img image.Image, options ProcessorOptions) ([]Profile, error) {
 	if err := options.Validate(); err != nil {
-		return nil, fmt.Errorf("failed to validate options")
+		return nil, fmt.Errorf("failed to validate options: %w", err)
 	}
 
-	result := map[int]float64{}
+	width := img.Bounds().Max.X
+	result := []Profile{{}}
+	var tracker *lineTracker
+	if options.Mode == ModeMultiLine {
+		tracker = newLineTracker(options.CalibrationResults.Lines, options.MaxLineShift)
+		result = make([]Profile, len(options.CalibrationResults.Lines))
+		for i, line := range options.CalibrationResults.Lines {
+			result[i].Offset = lateralPosition(line.meanBaseline(), width, options.CalibrationResults)
+		}
+	}
 
+	lasers := options.lasers()
+	var model mahalanobis
+	if options.ColorModel != nil {
+		model, _ = newMahalanobis(*options.ColorModel)
+	}
 	debugImage := image.NewRGBA(image.Rect(0, 0, img.Bounds().Max.X, img.Bounds().Max.Y))
 
 	minDiff := uint16(0)
@@ -115,68 +332,99 @@ func DetermineHeightPerLine(img image.Image, options ProcessorOptions) (map[int]
 		for x := range img.Bounds().Max.X {
 			pixels = append(pixels, img.At(x, y))
 		}
-		diffToLaserColor, err := slice.ConvertWithErr(pixels, func(pixel color.Color) (uint16, error) {
-			return ColorDistanceRedman(pixel, options.Lasercolor)
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to calculate diff to laser color for line %d: %w", y, err)
-		}
-
-		for _, diff := range diffToLaserColor {
-			if diff < minDiff {
-				minDiff = diff
+		diffs := make([][]uint16, len(lasers))
+		throughs := []int{}
+		labels := []int{}
+		for l, laser := range lasers {
+			distance := func(pixel color.Color) (uint16, error) {
+				return ColorDistanceRedman(pixel, laser.Color)
 			}
-			if diff > maxDiff {
-				maxDiff = diff
+			maxDeviation := laser.MaxColorDeviation
+			minThroughHeight := options.MinThroughHeight
+			if options.ColorModel != nil {
+				distance = model.distance
+			}
+			if options.Detection == DetectionIntensity {
+				distance = invertedIntensity
+				maxDeviation = math.MaxUint16 - options.MinIntensity
+				minThroughHeight = options.MinPeakHeight
+			}
+			diffToLaserColor, err := slice.ConvertWithErr(pixels, distance)
+			if err != nil {
+				return nil, fmt.Errorf("failed to calculate diff to laser color for line %d: %w", y, err)
 			}
-		}
 
-		diffToLaserColor = slice.Convert(diffToLaserColor, func(f uint16) uint16 {
-			if f > options.MaxColorDeviation {
-				return math.MaxUint16
+			for _, diff := range diffToLaserColor {
+				if diff < minDiff {
+					minDiff = diff
+				}
+				if diff > maxDiff {
+					maxDiff = diff
+				}
 			}
 
-			return f
-		})
-		for x := range len(diffToLaserColor) {
-			debugImage.Set(x, y, color.RGBA{R: uint8(diffToLaserColor[x] >> 8), G: uint8(diffToLaserColor[x] >> 8), B: uint8(diffToLaserColor[x] >> 8), A: 255})
-		}
+			diffToLaserColor = slice.Convert(diffToLaserColor, func(f uint16) uint16 {
+				if f > maxDeviation {
+					return math.MaxUint16
+				}
 
-		throughs, err := findThroughs(diffToLaserColor, options.MinThroughWidth, options.MinThroughHeight)
-		if err != nil {
-			return nil, fmt.Errorf("failed to find throughs: %w", err)
+				return f
+			})
+			diffs[l] = diffToLaserColor
+
+			laserThroughs, err := findThroughs(diffToLaserColor, options.MinThroughWidth, minThroughHeight)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find throughs: %w", err)
+			}
+			throughs = append(throughs, laserThroughs...)
+			for range laserThroughs {
+				labels = append(labels, l)
+			}
+		}
+		// the debug image shows the distance to the closest laser
+		for x := range width {
+			diff := uint16(math.MaxUint16)
+			for _, d := range diffs {
+				diff = min(diff, d[x])
+			}
+			debugImage.Set(x, y, color.RGBA{R: uint8(diff >> 8), G: uint8(diff >> 8), B: uint8(diff >> 8), A: 255})
 		}
 
 		//for x := range throughs {
 		//	debugImage.Set(x, y, color.RGBA{R: 255, G: 0, B: 0, A: 255})
 		//}
 
-		// what to do with the throughs?
-		// check if there are 1 or two (more should be an error)
-		// if 1 then we are at the gound level
-		// if 2 calculate the height
-		if len(throughs) == 1 {
-			result[y] = 0.0
-
-			continue
+		row := RowResult{Row: y, Throughs: throughs}
+		if len(lasers) > 1 {
+			row.Labels = labels
+			sortByPosition(row.Throughs, row.Labels)
 		}
-
-		if len(throughs) == 2 {
-			distBetweenPeaksInPixel := math.Abs(float64(throughs[0] - throughs[1]))
-			distBetweenPeaksInMM := distBetweenPeaksInPixel / options.CalibrationResults.PixelPerMM
-			result[y] = distBetweenPeaksInMM
-
+		row.Confidence = throughConfidence(diffs, row.Throughs, row.Labels)
+		switch {
+		case options.Mode == ModeMultiLine:
+			for i, lineRow := range tracker.rows(row, diffs[0]) {
+				if lineRow.Status.Valid() {
+					lineRow.Lateral = lateralPosition(meanPosition(lineRow.Throughs), width, options.CalibrationResults) - result[i].Offset
+				}
+				result[i].Rows = append(result[i].Rows, lineRow)
+			}
 			continue
+		case options.Mode == ModeSingleLine:
+			singleLineHeight(&row, options.CalibrationResults.Lines[0])
+		case len(lasers) == 2:
+			labelledHeight(&row, options.CalibrationResults)
+		default:
+			dualLineHeight(&row, options.CalibrationResults)
 		}
-
-		result[y] = -1
-
-		//return nil, fmt.Errorf("required 1 or 2 throughs but got %d for line %d (%v)", len(throughs), y, throughs)
+		if row.Status.Valid() {
+			row.Lateral = lateralPosition(meanPosition(row.Throughs), width, options.CalibrationResults)
+		}
+		result[0].Rows = append(result[0].Rows, row)
 	}
 
-	fmt.Printf("MinDiff: %d, MaxDiff: %d\n", minDiff, maxDiff)
-
 	if options.Debug.Enable {
+		// stdout carries the results of the commands
+		fmt.Fprintf(os.Stderr, "MinDiff: %d, MaxDiff: %d\n", minDiff, maxDiff)
 		os.Remove(options.Debug.Filenames["debugimage"])
 		f, err := os.OpenFile(options.Debug.Filenames["debugimage"], os.O_CREATE|os.O_WRONLY, 0x777)
 		if err != nil {
@@ -191,6 +439,187 @@ func DetermineHeightPerLine(img image.Image, options ProcessorOptions) (map[int]
 	return result, nil
 }
 
+// two lines meet at the plate, so a single through is the ground and the
+// distance of two throughs is the height. With calibrated lines a single
+// through is assigned to the line it belongs to, so rows where the other line
+// is hidden behind the object are still measured.
+func dualLineHeight(row *RowResult, calibration CalibrationResults) {
+	switch len(row.Throughs) {
+	case 1:
+		if len(calibration.Lines) == 2 {
+			recoverHiddenLine(row, calibration)
+			return
+		}
+		row.Height = 0.0
+		row.Status = StatusGround
+		row.Lines = []int{0, 1}
+	case 2:
+		distBetweenPeaksInPixel := math.Abs(float64(row.Throughs[0] - row.Throughs[1]))
+		row.Height = distBetweenPeaksInPixel / calibration.PixelPerMM
+		row.Status = StatusMeasured
+		row.Lines = []int{0, 1}
+	default:
+		row.Height = -1
+		row.Status = StatusInvalid
+	}
+}
+
+// the throughs are labelled by the laser they belong to, so the lines are told
+// apart even if they crossed. The height is the signed distance of the second
+// line to the first one, it is negative below the plate where the lines have
+// crossed. A through of one laser only is measured against the calibration of
+// its line if there is one and is the ground otherwise, where both lines meet
+// and only one of the colors might be found.
+func labelledHeight(row *RowResult, calibration CalibrationResults) {
+	row.Height = -1
+	row.Status = StatusInvalid
+	positions := [2][]int{}
+	for i, x := range row.Throughs {
+		positions[row.Labels[i]] = append(positions[row.Labels[i]], x)
+	}
+
+	switch {
+	case len(positions[0]) == 1 && len(positions[1]) == 1:
+		row.Height = float64(positions[1][0]-positions[0][0]) / calibration.PixelPerMM
+		row.Status = StatusMeasured
+		if row.Height == 0 {
+			row.Status = StatusGround
+		}
+		row.Lines = []int{0, 1}
+	case len(row.Throughs) == 1 && len(calibration.Lines) == 2:
+		line := row.Labels[0]
+		height, ok := calibration.Lines[line].HeightAt(row.Row, float64(row.Throughs[0]))
+		if !ok {
+			return
+		}
+		row.Height = height
+		row.Status = StatusMeasured
+		row.Lines = []int{line}
+	case len(row.Throughs) == 1:
+		row.Height = 0
+		row.Status = StatusGround
+		row.Lines = []int{0, 1}
+	}
+}
+
+// assigns a single through to a line by its baseline and the direction the
+// line moves with the height. A through that is on the baseline of every line
+// is the ground. A through that fits one line only is measured with that line,
+// one that fits both is ambiguous and the row is invalid. Throughs within the
+// width of the laser of a baseline count as on it.
+func recoverHiddenLine(row *RowResult, calibration CalibrationResults) {
+	row.Height = -1
+	row.Status = StatusInvalid
+	x := float64(row.Throughs[0])
+	tolerance := math.Max(1, calibration.WidthOfLaser)
+
+	candidates := []int{}
+	onBaseline := 0
+	for i, line := range calibration.Lines {
+		if row.Row >= len(line.Baseline) || line.Baseline[row.Row] < 0 || line.ShiftPerMM == 0 {
+			return
+		}
+		// distance in pixel the line moved up from the plate
+		d := (x - line.Baseline[row.Row]) * math.Copysign(1, line.ShiftPerMM)
+		if math.Abs(d) <= tolerance {
+			onBaseline++
+		}
+		if d >= -tolerance {
+			candidates = append(candidates, i)
+		}
+	}
+
+	switch {
+	case onBaseline == len(calibration.Lines):
+		row.Height = 0
+		row.Status = StatusGround
+		row.Lines = candidates
+	case len(candidates) == 1:
+		height, _ := calibration.Lines[candidates[0]].HeightAt(row.Row, x)
+		row.Height = math.Max(0, height)
+		row.Status = StatusMeasured
+		row.Lines = candidates
+	}
+}
+
+// a single line is shifted against its baseline by the height, to either side
+// depending on the sign of the height
+func singleLineHeight(row *RowResult, line LineCalibration) {
+	row.Height = -1
+	row.Status = StatusInvalid
+	if len(row.Throughs) != 1 {
+		return
+	}
+	height, ok := line.HeightAt(row.Row, float64(row.Throughs[0]))
+	if !ok {
+		return
+	}
+	row.Height = height
+	row.Status = StatusMeasured
+	row.Lines = []int{0}
+}
+
+// returns the midpoint of the throughs in pixel
+func meanPosition(throughs []int) float64 {
+	sum := 0.0
+	for _, x := range throughs {
+		sum += float64(x)
+	}
+
+	return sum / float64(len(throughs))
+}
+
+// converts a column in pixel into mm relative to the lateral origin
+func lateralPosition(x float64, width int, calibration CalibrationResults) float64 {
+	// without a scale the position can not be converted
+	if calibration.PixelPerMM <= 0 {
+		return 0
+	}
+	origin := calibration.LateralOrigin
+	if origin < 0 {
+		origin = float64(width-1) / 2
+	}
+
+	return (x - origin) / calibration.PixelPerMM
+}
+
+// calculates how close the throughs are to the color of their laser, 1 is a
+// perfect match. Without labels all throughs belong to the first laser.
+func throughConfidence(diffs [][]uint16, throughs []int, labels []int) float64 {
+	if len(throughs) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for i, x := range throughs {
+		laser := 0
+		if labels != nil {
+			laser = labels[i]
+		}
+		sum += 1 - float64(diffs[laser][x])/math.MaxUint16
+	}
+
+	return sum / float64(len(throughs))
+}
+
+// sorts the throughs of all lasers by their position and keeps the labels in
+// the same order
+func sortByPosition(throughs []int, labels []int) {
+	sort.Sort(labelledThroughs{throughs, labels})
+}
+
+type labelledThroughs struct {
+	throughs []int
+	labels   []int
+}
+
+func (lt labelledThroughs) Len() int           { return len(lt.throughs) }
+func (lt labelledThroughs) Less(i, j int) bool { return lt.throughs[i] < lt.throughs[j] }
+func (lt labelledThroughs) Swap(i, j int) {
+	lt.throughs[i], lt.throughs[j] = lt.throughs[j], lt.throughs[i]
+	lt.labels[i], lt.labels[j] = lt.labels[j], lt.labels[i]
+}
+
 // analyzes the array of numbers and returns an array of throughs to find out
 // where the color is closest to the color of the laser
 func findThroughs(numbers []uint16, minThroughWidth int, minThroughHeight uint16) ([]int, error) {
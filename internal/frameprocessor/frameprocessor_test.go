@@ -5,6 +5,7 @@ import (
 	"image"
 	"image/color"
 	"image/jpeg"
+	"math"
 	"math/rand"
 	"os"
 	"reflect"
@@ -335,3 +336,400 @@ func TestDetermineHeightPerLine(t *testing.T) {
 		}
 	}
 }
+
+// an image that is 9px wide with the laser at the given positions of every row
+func lineImage(positions ...[]int) image.Image {
+	return wideLineImage(9, positions...)
+}
+
+// returns an image of the given width with a red pixel at the positions of
+// every row
+func wideLineImage(width int, positions ...[]int) image.Image {
+	pixels := [][]color.Color{}
+	for _, lines := range positions {
+		row := []color.Color{}
+		for range width {
+			row = append(row, color.Transparent)
+		}
+		for _, x := range lines {
+			row[x] = colorRed
+		}
+		pixels = append(pixels, row)
+	}
+
+	return convertColorArrayToImage(pixels, 0)
+}
+
+// an image with a single line at the given position of every row
+func singleLineImage(positions []int) image.Image {
+	lines := [][]int{}
+	for _, x := range positions {
+		lines = append(lines, []int{x})
+	}
+
+	return lineImage(lines...)
+}
+
+func TestSingleLineMode(t *testing.T) {
+	options := NewProcessorOptions()
+	options.MinThroughWidth = 3
+	options.Mode = ModeSingleLine
+	options.CalibrationResults.Lines = []LineCalibration{{Baseline: []float64{4, 4, 4, -1}, ShiftPerMM: 2}}
+
+	profile, err := DetermineProfile(singleLineImage([]int{4, 6, 1, 4}), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		height float64
+		status Status
+	}{
+		{height: 0, status: StatusMeasured},
+		{height: 1, status: StatusMeasured},
+		{height: -1.5, status: StatusMeasured},
+		{height: -1, status: StatusInvalid}, // no baseline
+	}
+	for i, row := range profile.Rows {
+		if row.Height != want[i].height || row.Status != want[i].status {
+			t.Errorf("row %d = %f (%s), want %f (%s)", i, row.Height, row.Status, want[i].height, want[i].status)
+		}
+	}
+
+	options.CalibrationResults.Lines = nil
+	if _, err := DetermineProfile(singleLineImage([]int{4}), options); err == nil {
+		t.Errorf("DetermineProfile() in single-line mode without calibration should fail")
+	}
+}
+
+func TestCalibrateSingleLine(t *testing.T) {
+	options := NewProcessorOptions()
+	options.MinThroughWidth = 3
+
+	// the 2mm block covers the rows 1 and 2
+	got, err := CalibrateSingleLine(singleLineImage([]int{4, 4, 3}), singleLineImage([]int{4, 7, 6}), 2, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Baseline, []float64{4, 4, 3}) || got.ShiftPerMM != 1.5 {
+		t.Errorf("CalibrateSingleLine() = %+v, want baseline [4 4 3] and 1.5 pixel per mm", got)
+	}
+
+	if _, err := CalibrateSingleLine(singleLineImage([]int{4}), singleLineImage([]int{4}), 2, options); err == nil {
+		t.Errorf("CalibrateSingleLine() without shift should fail")
+	}
+}
+
+func TestHiddenLineRecovery(t *testing.T) {
+	options := NewProcessorOptions()
+	options.MinThroughWidth = 3
+	options.CalibrationResults.PixelPerMM = 2
+	// both lines meet at 4 on the plate, except in the last row, and move
+	// apart by one pixel per mm each
+	options.CalibrationResults.Lines = []LineCalibration{
+		{Baseline: []float64{4, 4, 4, 4, 2}, ShiftPerMM: 1},
+		{Baseline: []float64{4, 4, 4, 4, 6}, ShiftPerMM: -1},
+	}
+
+	profile, err := DetermineProfile(lineImage([]int{4}, []int{2, 6}, []int{7}, []int{1}, []int{4}), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lateral position is relative to the center column 4
+	want := []struct {
+		height  float64
+		status  Status
+		lines   []int
+		lateral float64
+	}{
+		{height: 0, status: StatusGround, lines: []int{0, 1}, lateral: 0},
+		{height: 2, status: StatusMeasured, lines: []int{0, 1}, lateral: 0},
+		{height: 3, status: StatusMeasured, lines: []int{0}, lateral: 1.5},  // second line hidden
+		{height: 3, status: StatusMeasured, lines: []int{1}, lateral: -1.5}, // first line hidden
+		{height: -1, status: StatusInvalid, lines: nil, lateral: 0},         // fits both lines
+	}
+	for i, row := range profile.Rows {
+		if row.Height != want[i].height || row.Status != want[i].status || !reflect.DeepEqual(row.Lines, want[i].lines) {
+			t.Errorf("row %d = %f (%s) from lines %v, want %f (%s) from lines %v", i, row.Height, row.Status, row.Lines, want[i].height, want[i].status, want[i].lines)
+		}
+		if row.Lateral != want[i].lateral {
+			t.Errorf("row %d is at %f mm across the frame, want %f", i, row.Lateral, want[i].lateral)
+		}
+	}
+
+	options.CalibrationResults.LateralOrigin = 0
+	profile, err = DetermineProfile(lineImage([]int{4}), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Rows[0].Lateral != 2 {
+		t.Errorf("row 0 is at %f mm from column 0, want 2", profile.Rows[0].Lateral)
+	}
+}
+
+func TestMultiLineMode(t *testing.T) {
+	options := NewProcessorOptions()
+	options.MinThroughWidth = 3
+	options.Mode = ModeMultiLine
+	options.MaxLineShift = 2
+	options.CalibrationResults.PixelPerMM = 2
+	options.CalibrationResults.Lines = []LineCalibration{
+		{Baseline: []float64{4, 4, 4, 4, 4, 4, 4}, ShiftPerMM: 2},
+		{Baseline: []float64{10, 10, 10, 10, 10, 10, 10}, ShiftPerMM: 2},
+		{Baseline: []float64{16, 16, 16, 16, 16, 16, 16}, ShiftPerMM: 2},
+	}
+
+	profiles, err := DetermineLineProfiles(wideLineImage(21,
+		[]int{4, 10, 16}, // all lines on the plate
+		[]int{6, 12, 18}, // all lines on the object
+		[]int{8, 14},     // the last line is hidden
+		[]int{11},        // too far from every tracked line
+		[]int{9, 15, 19}, // all lines again
+		[]int{4, 13, 17}, // steps are assigned by the order
+		[]int{4, 16, 19}, // the middle line is hidden and a reflection is seen
+	), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 3 {
+		t.Fatalf("DetermineLineProfiles() returned %d profiles, want 3", len(profiles))
+	}
+
+	u := math.NaN()
+	want := [][]float64{
+		{0, 1, 2, u, 2.5, 0, u},
+		{0, 1, 2, u, 2.5, 1.5, u},
+		{0, 1, -1, u, 1.5, 0.5, u},
+	}
+	unresolved := map[int]bool{3: true, 6: true}
+	for i, profile := range profiles {
+		for row, result := range profile.Rows {
+			switch {
+			case unresolved[row]:
+				if result.Status != StatusUnresolved {
+					t.Errorf("line %d row %d is %s, want unresolved", i, row, result.Status)
+				}
+			case want[i][row] < 0:
+				if result.Status != StatusInvalid {
+					t.Errorf("line %d row %d is %s, want invalid", i, row, result.Status)
+				}
+			case result.Status != StatusMeasured || result.Height != want[i][row]:
+				t.Errorf("line %d row %d = %f (%s), want %f (measured)", i, row, result.Height, result.Status, want[i][row])
+			}
+		}
+	}
+
+	// the lines are 3 mm apart and the rows are relative to their line
+	for i, offset := range []float64{-3, 0, 3} {
+		if profiles[i].Offset != offset {
+			t.Errorf("line %d is at %f mm, want %f", i, profiles[i].Offset, offset)
+		}
+		if profiles[i].Rows[1].Lateral != 1 {
+			t.Errorf("row 1 of line %d is at %f mm from the line, want 1", i, profiles[i].Rows[1].Lateral)
+		}
+	}
+
+	if _, err := DetermineProfile(wideLineImage(21, []int{4, 10, 16}), options); err == nil {
+		t.Errorf("DetermineProfile() in the multi-line mode should fail")
+	}
+}
+
+func TestCalibrateLines(t *testing.T) {
+	options := NewProcessorOptions()
+	options.MinThroughWidth = 3
+
+	// the 2mm block covers the rows 1 and 2, row 3 misses a line on the plate
+	plate := wideLineImage(21, []int{4, 10, 16}, []int{4, 10, 16}, []int{4, 10, 16}, []int{4, 16})
+	block := wideLineImage(21, []int{4, 10, 16}, []int{8, 14, 18}, []int{8, 14, 18}, []int{4, 16})
+	got, err := CalibrateLines(plate, block, 2, 3, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LineCalibration{
+		{Baseline: []float64{4, 4, 4, -1}, ShiftPerMM: 2},
+		{Baseline: []float64{10, 10, 10, -1}, ShiftPerMM: 2},
+		{Baseline: []float64{16, 16, 16, -1}, ShiftPerMM: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CalibrateLines() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLabelledLasers(t *testing.T) {
+	colorGreen := color.RGBA{G: 255, A: 255}
+	options := NewProcessorOptions()
+	options.MinThroughWidth = 3
+	options.CalibrationResults.PixelPerMM = 2
+	options.Lasers = []Laser{
+		{Color: colorRed, MaxColorDeviation: 10000},
+		{Color: colorGreen, MaxColorDeviation: 10000},
+	}
+
+	pixels := [][]color.Color{}
+	for _, lines := range []map[int]color.Color{
+		{4: colorRed},                             // only one color where the lines meet
+		{2: colorRed, 6: colorGreen},              // above the plate
+		{2: colorGreen, 6: colorRed},              // the lines crossed below the plate
+		{2: colorRed, 4: colorGreen, 6: colorRed}, // two red lines
+		{6: colorGreen},                           // the red line is hidden
+	} {
+		row := []color.Color{}
+		for x := range 9 {
+			c, ok := lines[x]
+			if !ok {
+				c = color.Transparent
+			}
+			row = append(row, c)
+		}
+		pixels = append(pixels, row)
+	}
+	img := convertColorArrayToImage(pixels, 0)
+
+	tests := []struct {
+		name  string
+		lines []LineCalibration
+		want  []float64
+		state []Status
+	}{
+		{
+			name:  "without calibration",
+			want:  []float64{0, 2, -2, -1, 0},
+			state: []Status{StatusGround, StatusMeasured, StatusMeasured, StatusInvalid, StatusGround},
+		},
+		{
+			name: "with calibration",
+			lines: []LineCalibration{
+				{Baseline: []float64{4, 4, 4, 4, 4}, ShiftPerMM: -1},
+				{Baseline: []float64{4, 4, 4, 4, 4}, ShiftPerMM: 1},
+			},
+			want:  []float64{0, 2, -2, -1, 2},
+			state: []Status{StatusMeasured, StatusMeasured, StatusMeasured, StatusInvalid, StatusMeasured},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options.CalibrationResults.Lines = tt.lines
+			profile, err := DetermineProfile(img, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, row := range profile.Rows {
+				if row.Height != tt.want[i] || row.Status != tt.state[i] {
+					t.Errorf("row %d = %f (%s), want %f (%s)", i, row.Height, row.Status, tt.want[i], tt.state[i])
+				}
+			}
+			if !reflect.DeepEqual(profile.Rows[2].Labels, []int{1, 0}) {
+				t.Errorf("labels of row 2 = %v, want [1 0]", profile.Rows[2].Labels)
+			}
+		})
+	}
+
+	options.Mode = ModeSingleLine
+	if err := options.Validate(); err == nil {
+		t.Errorf("Validate() with two lasers in the single-line mode should fail")
+	}
+}
+
+func TestIntensityDetection(t *testing.T) {
+	options := NewProcessorOptions()
+	options.MinThroughWidth = 3
+	options.Detection = DetectionIntensity
+	options.CalibrationResults.PixelPerMM = 2
+
+	rows := []struct {
+		background uint16
+		peaks      map[int]uint16
+		height     float64
+		status     Status
+	}{
+		{background: 0x1000, peaks: map[int]uint16{4: 0xf000}, height: 0, status: StatusGround},
+		{background: 0x1000, peaks: map[int]uint16{2: 0xf000, 6: 0xe000}, height: 2, status: StatusMeasured},
+		{background: 0x1000, peaks: map[int]uint16{4: 0x3000}, height: -1, status: StatusInvalid}, // too dark
+		{background: 0x4c00, peaks: map[int]uint16{4: 0x5000}, height: -1, status: StatusInvalid}, // too flat
+	}
+	gray16 := image.NewGray16(image.Rect(0, 0, 9, len(rows)))
+	gray8 := image.NewGray(image.Rect(0, 0, 9, len(rows)))
+	for y, row := range rows {
+		for x := range 9 {
+			v, ok := row.peaks[x]
+			if !ok {
+				v = row.background
+			}
+			gray16.SetGray16(x, y, color.Gray16{Y: v})
+			gray8.SetGray(x, y, color.Gray{Y: uint8(v >> 8)})
+		}
+	}
+
+	for name, img := range map[string]image.Image{"16 bit": gray16, "8 bit": gray8} {
+		t.Run(name, func(t *testing.T) {
+			profile, err := DetermineProfile(img, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, row := range profile.Rows {
+				if row.Height != rows[i].height || row.Status != rows[i].status {
+					t.Errorf("row %d = %f (%s), want %f (%s)", i, row.Height, row.Status, rows[i].height, rows[i].status)
+				}
+			}
+		})
+	}
+}
+
+func TestColorModel(t *testing.T) {
+	// the laser is orange-white in the bright rows and dark red in the others,
+	// column 15 is a dim red reflection
+	core := color.RGBA{R: 255, G: 190, B: 140, A: 255}
+	edge := color.RGBA{R: 220, G: 40, B: 30, A: 255}
+	pixels := [][]color.Color{}
+	for y := range 20 {
+		row := []color.Color{}
+		for range 20 {
+			row = append(row, color.RGBA{R: 40, G: 40, B: 40, A: 255})
+		}
+		row[10] = core
+		if y%2 == 1 {
+			row[10] = edge
+		}
+		row[15] = color.RGBA{R: 90, G: 10, B: 10, A: 255}
+		pixels = append(pixels, row)
+	}
+	img := convertColorArrayToImage(pixels, 0)
+
+	estimateOptions := NewEstimateOptions()
+	estimateOptions.Fraction = 0.5
+	model, err := EstimateColorModel([]image.Image{img}, estimateOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := model.Color(), (color.RGBA{R: 238, G: 115, B: 85, A: 255}); got != want {
+		t.Errorf("Color() = %v, want %v", got, want)
+	}
+
+	options := NewProcessorOptions()
+	options.MinThroughWidth = 3
+	count := func() int {
+		profile, err := DetermineProfile(img, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, row := range profile.Rows {
+			if row.Status == StatusGround && reflect.DeepEqual(row.Throughs, []int{10}) {
+				n++
+			}
+		}
+		return n
+	}
+	if n := count(); n != 10 {
+		t.Errorf("%d rows found with the default laser color, want the 10 dark red ones", n)
+	}
+	options.ColorModel = &model
+	options.MaxColorDeviation = 3000
+	if n := count(); n != 20 {
+		t.Errorf("%d rows found with the color model, want 20", n)
+	}
+
+	estimateOptions.MinSamples = 100
+	if _, err := EstimateColorModel([]image.Image{img}, estimateOptions); err == nil {
+		t.Errorf("EstimateColorModel() with too few laser pixels should fail")
+	}
+}
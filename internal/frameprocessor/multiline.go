@@ -0,0 +1,126 @@
+package frameprocessor
+
+import (
+	"math"
+	"sort"
+)
+
+// lineTracker assigns the throughs of the rows to the projector lines of the
+// multi-line mode. It remembers how far every line moved from its baseline in
+// the last row it was found in, so the lines can still be told apart in rows
+// where some of them are hidden.
+type lineTracker struct {
+	lines    []LineCalibration
+	maxShift float64
+	shift    []float64 // pixels every line moved from its baseline, all lines start on the plate
+}
+
+func newLineTracker(lines []LineCalibration, maxShift float64) *lineTracker {
+	return &lineTracker{lines: lines, maxShift: maxShift, shift: make([]float64, len(lines))}
+}
+
+// rows splits the row into one row per line. Lines without a through in the
+// row are invalid, all lines of a row that can not be assigned without
+// ambiguity are unresolved and keep all throughs of the row.
+func (lt *lineTracker) rows(row RowResult, diffToLaserColor []uint16) []RowResult {
+	result := make([]RowResult, len(lt.lines))
+	for i := range result {
+		result[i] = RowResult{Row: row.Row, Height: -1, Status: StatusInvalid}
+	}
+
+	assignment, ok := lt.assign(row.Row, row.Throughs)
+	if !ok {
+		for i := range result {
+			result[i].Throughs = row.Throughs
+			result[i].Status = StatusUnresolved
+		}
+		return result
+	}
+
+	for t, i := range assignment {
+		x := row.Throughs[t]
+		height, _ := lt.lines[i].HeightAt(row.Row, float64(x))
+		lt.shift[i] = float64(x) - lt.lines[i].Baseline[row.Row]
+		result[i].Throughs = []int{x}
+		result[i].Height = height
+		result[i].Status = StatusMeasured
+		result[i].Confidence = throughConfidence([][]uint16{diffToLaserColor}, []int{x}, nil)
+		result[i].Lines = []int{i}
+	}
+
+	return result
+}
+
+// assign returns the line of every through. If every line with a baseline in
+// the row has a through, they are assigned by their order unless a through is
+// tracked to a different line. Otherwise every through has to be tracked to
+// exactly one line, in the order of the lines.
+func (lt *lineTracker) assign(row int, throughs []int) ([]int, bool) {
+	// lines with a baseline in this row, ordered by their position on the plate
+	lines := []int{}
+	for i, line := range lt.lines {
+		if row < len(line.Baseline) && line.Baseline[row] >= 0 {
+			lines = append(lines, i)
+		}
+	}
+	sort.SliceStable(lines, func(a, b int) bool {
+		return lt.lines[lines[a]].Baseline[row] < lt.lines[lines[b]].Baseline[row]
+	})
+
+	candidates := make([][]int, len(throughs))
+	for t, x := range throughs {
+		for rank, i := range lines {
+			if math.Abs(float64(x)-lt.lines[i].Baseline[row]-lt.shift[i]) <= lt.maxShift {
+				candidates[t] = append(candidates[t], rank)
+			}
+		}
+	}
+
+	if len(throughs) == len(lines) {
+		for t := range throughs {
+			if len(candidates[t]) > 0 && !contains(candidates[t], t) {
+				return nil, false
+			}
+		}
+		return lines, true
+	}
+
+	assignment := make([]int, len(throughs))
+	last := -1
+	for t := range throughs {
+		if len(candidates[t]) != 1 || candidates[t][0] <= last {
+			return nil, false
+		}
+		last = candidates[t][0]
+		assignment[t] = lines[last]
+	}
+
+	return assignment, true
+}
+
+// returns the mean position of the line on the plate in pixel
+func (lc LineCalibration) meanBaseline() float64 {
+	sum := 0.0
+	n := 0
+	for _, x := range lc.Baseline {
+		if x >= 0 {
+			sum += x
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+
+	return sum / float64(n)
+}
+
+func contains(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,127 @@
+package heightmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+)
+
+// file is the JSON representation of a height map. JSON has no NaN, so cells
+// without a measurement are null.
+type file struct {
+	Rows           int                       `json:"rows"`
+	RowSpacing     float64                   `json:"row_spacing"`
+	RowOffset      float64                   `json:"row_offset"`
+	FeedPerFrame   float64                   `json:"feed_per_frame"`
+	FramePositions []float64                 `json:"frame_positions"`
+	Heights        [][]*float64              `json:"heights"`
+	Confidence     [][]float64               `json:"confidence"`
+	Lateral        [][]float64               `json:"lateral,omitempty"`
+	Status         [][]frameprocessor.Status `json:"status,omitempty"`
+	Interpolated   [][]bool                  `json:"interpolated,omitempty"`
+}
+
+// Write stores the height map as JSON, e.g. to keep a scan as reference.
+// Colors are not stored.
+func (hm *HeightMap) Write(w io.Writer) error {
+	f := file{
+		Rows:           hm.rows,
+		RowSpacing:     hm.RowSpacing,
+		RowOffset:      hm.RowOffset,
+		FeedPerFrame:   hm.feedPerFrame,
+		FramePositions: hm.FramePositions,
+		Heights:        make([][]*float64, len(hm.Heights)),
+		Confidence:     hm.Confidence,
+		Lateral:        hm.Lateral,
+		Status:         hm.Status,
+		Interpolated:   hm.Interpolated,
+	}
+	for frame := range hm.Heights {
+		f.Heights[frame] = make([]*float64, hm.rows)
+		for row := range hm.rows {
+			if hm.Valid(frame, row) {
+				h := hm.Heights[frame][row]
+				f.Heights[frame][row] = &h
+			}
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		return fmt.Errorf("failed to encode height map: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads a height map that was stored with Write.
+func Read(r io.Reader) (*HeightMap, error) {
+	f := file{}
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("failed to decode height map: %w", err)
+	}
+	if len(f.Heights) != len(f.FramePositions) {
+		return nil, fmt.Errorf("the height map has %d frames but %d frame positions", len(f.Heights), len(f.FramePositions))
+	}
+
+	options := NewOptions()
+	options.Rows, options.RowSpacing, options.RowOffset, options.FeedPerFrame = f.Rows, f.RowSpacing, f.RowOffset, f.FeedPerFrame
+	hm, err := New(options)
+	if err != nil {
+		return nil, err
+	}
+	for frame, cells := range f.Heights {
+		if len(cells) != f.Rows {
+			return nil, fmt.Errorf("frame %d has %d rows but the height map has %d", frame, len(cells), f.Rows)
+		}
+		heights := make([]float64, f.Rows)
+		status := make([]frameprocessor.Status, f.Rows)
+		for row, h := range cells {
+			heights[row] = math.NaN()
+			if h != nil {
+				heights[row] = *h
+				status[row] = frameprocessor.StatusMeasured
+			}
+		}
+		// files written before the status was stored have measured cells only
+		if frame < len(f.Status) && len(f.Status[frame]) == f.Rows {
+			status = f.Status[frame]
+		}
+		confidence := validConfidence(heights)
+		if frame < len(f.Confidence) && len(f.Confidence[frame]) == f.Rows {
+			confidence = f.Confidence[frame]
+		}
+		var lateral []float64
+		if frame < len(f.Lateral) && len(f.Lateral[frame]) == f.Rows {
+			lateral = f.Lateral[frame]
+		}
+		hm.appendFrame(heights, f.FramePositions[frame], confidence, status, nil, lateral)
+	}
+	if f.Interpolated != nil {
+		if len(f.Interpolated) != len(f.Heights) {
+			return nil, fmt.Errorf("the height map has %d frames but %d frames of interpolated cells", len(f.Heights), len(f.Interpolated))
+		}
+		for frame, cells := range f.Interpolated {
+			if len(cells) != f.Rows {
+				return nil, fmt.Errorf("frame %d has %d interpolated cells but the height map has %d rows", frame, len(cells), f.Rows)
+			}
+		}
+		hm.Interpolated = f.Interpolated
+	}
+
+	return hm, nil
+}
+
+// Load reads a height map from a file that was stored with Write.
+func Load(filename string) (*HeightMap, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open height map: %w", err)
+	}
+	defer f.Close()
+
+	return Read(f)
+}
@@ -0,0 +1,249 @@
+package heightmap
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+)
+
+// IsInterpolated returns true if the cell was filled by FillHoles and should
+// be excluded from measurements.
+func (hm *HeightMap) IsInterpolated(frame int, row int) bool {
+	if hm.Interpolated == nil || frame < 0 || frame >= len(hm.Interpolated) || row < 0 || row >= hm.rows {
+		return false
+	}
+
+	return hm.Interpolated[frame][row]
+}
+
+// Measured returns true if the cell has a valid measurement that was not
+// interpolated.
+func (hm *HeightMap) Measured(frame int, row int) bool {
+	return hm.Valid(frame, row) && !hm.IsInterpolated(frame, row)
+}
+
+// returns the valid heights in the window around the cell, without the cell itself
+func (hm *HeightMap) neighbours(frame int, row int, radius int) []float64 {
+	result := []float64{}
+	for f := frame - radius; f <= frame+radius; f++ {
+		for r := row - radius; r <= row+radius; r++ {
+			if (f == frame && r == row) || !hm.Valid(f, r) {
+				continue
+			}
+			result = append(result, hm.At(f, r))
+		}
+	}
+
+	return result
+}
+
+func (hm *HeightMap) invalidate(frame int, row int) {
+	hm.Heights[frame][row] = math.NaN()
+	hm.Confidence[frame][row] = 0
+	hm.Status[frame][row] = frameprocessor.StatusInvalid
+	if hm.Interpolated != nil {
+		hm.Interpolated[frame][row] = false
+	}
+}
+
+// RemoveMedianOutliers removes every cell that deviates more than maxDeviation
+// mm from the median of its neighbours in a window of size x size cells.
+// It returns the number of removed cells.
+func (hm *HeightMap) RemoveMedianOutliers(size int, maxDeviation float64) (int, error) {
+	if size < 3 || size%2 != 1 {
+		return 0, fmt.Errorf("the window size needs to be an uneven number of at least 3 but is %d", size)
+	}
+
+	outliers := [][2]int{}
+	for frame := range hm.Heights {
+		for row := range hm.rows {
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			neighbours := hm.neighbours(frame, row, size/2)
+			if len(neighbours) == 0 {
+				continue
+			}
+			if math.Abs(hm.At(frame, row)-median(neighbours)) > maxDeviation {
+				outliers = append(outliers, [2]int{frame, row})
+			}
+		}
+	}
+
+	for _, cell := range outliers {
+		hm.invalidate(cell[0], cell[1])
+	}
+
+	return len(outliers), nil
+}
+
+// RemoveStatisticalOutliers removes every cell whose distance to the mean of
+// its neighbours in a window of size x size cells is more than stdDevs times
+// their standard deviation. It returns the number of removed cells.
+func (hm *HeightMap) RemoveStatisticalOutliers(size int, stdDevs float64) (int, error) {
+	if size < 3 || size%2 != 1 {
+		return 0, fmt.Errorf("the window size needs to be an uneven number of at least 3 but is %d", size)
+	}
+
+	outliers := [][2]int{}
+	for frame := range hm.Heights {
+		for row := range hm.rows {
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			neighbours := hm.neighbours(frame, row, size/2)
+			if len(neighbours) < 2 {
+				continue
+			}
+			mean, stdDev := meanAndStdDev(neighbours)
+			if math.Abs(hm.At(frame, row)-mean) > stdDevs*stdDev {
+				outliers = append(outliers, [2]int{frame, row})
+			}
+		}
+	}
+
+	for _, cell := range outliers {
+		hm.invalidate(cell[0], cell[1])
+	}
+
+	return len(outliers), nil
+}
+
+// FillHoles fills every hole of at most maxSize cells by solving the Laplace
+// equation with the surrounding cells as boundary, which gives the smoothest
+// surface that meets the edge of the hole. Holes that touch the border of the
+// height map are not enclosed and stay empty. The filled cells are marked in
+// Interpolated and get a confidence of 0. It returns the number of filled cells.
+func (hm *HeightMap) FillHoles(maxSize int) int {
+	visited := make([][]bool, len(hm.Heights))
+	for frame := range visited {
+		visited[frame] = make([]bool, hm.rows)
+	}
+
+	filled := 0
+	for frame := range hm.Heights {
+		for row := range hm.rows {
+			if visited[frame][row] || hm.Valid(frame, row) {
+				continue
+			}
+
+			hole, touchesBorder := hm.collectHole(frame, row, visited)
+			if touchesBorder || len(hole) > maxSize {
+				continue
+			}
+			hm.fillLaplace(hole)
+			filled += len(hole)
+		}
+	}
+
+	return filled
+}
+
+// collects the 4-connected invalid cells starting at the given cell
+func (hm *HeightMap) collectHole(frame int, row int, visited [][]bool) ([][2]int, bool) {
+	hole := [][2]int{}
+	touchesBorder := false
+	stack := [][2]int{{frame, row}}
+	visited[frame][row] = true
+	for len(stack) > 0 {
+		cell := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		hole = append(hole, cell)
+
+		for _, n := range [][2]int{{cell[0] - 1, cell[1]}, {cell[0] + 1, cell[1]}, {cell[0], cell[1] - 1}, {cell[0], cell[1] + 1}} {
+			if n[0] < 0 || n[0] >= len(hm.Heights) || n[1] < 0 || n[1] >= hm.rows {
+				touchesBorder = true
+				continue
+			}
+			if visited[n[0]][n[1]] || hm.Valid(n[0], n[1]) {
+				continue
+			}
+			visited[n[0]][n[1]] = true
+			stack = append(stack, n)
+		}
+	}
+
+	return hole, touchesBorder
+}
+
+// relaxes the hole until every cell is the mean of its 4 neighbours
+func (hm *HeightMap) fillLaplace(hole [][2]int) {
+	const (
+		maxIterations = 10000
+		tolerance     = 1e-6
+	)
+
+	// start with the mean of the boundary to converge faster
+	boundary := []float64{}
+	for _, cell := range hole {
+		for _, n := range [][2]int{{cell[0] - 1, cell[1]}, {cell[0] + 1, cell[1]}, {cell[0], cell[1] - 1}, {cell[0], cell[1] + 1}} {
+			if hm.Valid(n[0], n[1]) {
+				boundary = append(boundary, hm.At(n[0], n[1]))
+			}
+		}
+	}
+	start, _ := meanAndStdDev(boundary)
+	for _, cell := range hole {
+		hm.Heights[cell[0]][cell[1]] = start
+	}
+
+	for range maxIterations {
+		maxChange := 0.0
+		for _, cell := range hole {
+			sum := 0.0
+			for _, n := range [][2]int{{cell[0] - 1, cell[1]}, {cell[0] + 1, cell[1]}, {cell[0], cell[1] - 1}, {cell[0], cell[1] + 1}} {
+				sum += hm.At(n[0], n[1])
+			}
+			h := sum / 4
+			maxChange = math.Max(maxChange, math.Abs(h-hm.Heights[cell[0]][cell[1]]))
+			hm.Heights[cell[0]][cell[1]] = h
+		}
+		if maxChange < tolerance {
+			break
+		}
+	}
+
+	if hm.Interpolated == nil {
+		hm.Interpolated = make([][]bool, len(hm.Heights))
+		for frame := range hm.Interpolated {
+			hm.Interpolated[frame] = make([]bool, hm.rows)
+		}
+	}
+	for _, cell := range hole {
+		hm.Interpolated[cell[0]][cell[1]] = true
+		hm.Confidence[cell[0]][cell[1]] = 0
+	}
+}
+
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	if len(sorted)%2 == 1 {
+		return sorted[len(sorted)/2]
+	}
+
+	return (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+}
+
+func meanAndStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return math.NaN(), math.NaN()
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
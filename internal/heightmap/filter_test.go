@@ -0,0 +1,85 @@
+package heightmap
+
+import (
+	"math"
+	"testing"
+)
+
+// builds a 5x5 height map with a slope of 1mm per frame
+func newSlope(t *testing.T) *HeightMap {
+	options := NewOptions()
+	options.Rows = 5
+	hm, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for frame := range 5 {
+		heights := make([]float64, 5)
+		for row := range heights {
+			heights[row] = float64(frame)
+		}
+		if err := hm.AddHeightsAt(heights, float64(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return hm
+}
+
+func TestRemoveOutliers(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(hm *HeightMap) (int, error)
+	}{
+		{name: "median", remove: func(hm *HeightMap) (int, error) { return hm.RemoveMedianOutliers(3, 1) }},
+		{name: "statistical", remove: func(hm *HeightMap) (int, error) { return hm.RemoveStatisticalOutliers(3, 3) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hm := newSlope(t)
+			hm.Heights[2][2] = 20
+
+			removed, err := tt.remove(hm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != 1 {
+				t.Errorf("removed %d cells, want 1", removed)
+			}
+			if hm.Valid(2, 2) {
+				t.Errorf("the spike at 2,2 was not removed")
+			}
+		})
+	}
+}
+
+func TestFillHoles(t *testing.T) {
+	hm := newSlope(t)
+	hm.Heights[2][2] = math.NaN()
+	hm.Heights[2][1] = math.NaN()
+	// touches the border, so it is not a hole
+	hm.Heights[0][4] = math.NaN()
+
+	if filled := hm.FillHoles(1); filled != 0 {
+		t.Errorf("FillHoles(1) filled %d cells of a hole with 2 cells", filled)
+	}
+
+	filled := hm.FillHoles(2)
+	if filled != 2 {
+		t.Errorf("FillHoles(2) filled %d cells, want 2", filled)
+	}
+	for _, cell := range [][2]int{{2, 2}, {2, 1}} {
+		if h := hm.At(cell[0], cell[1]); math.Abs(h-2) > 1e-4 {
+			t.Errorf("filled cell %v = %f, want 2", cell, h)
+		}
+		if !hm.IsInterpolated(cell[0], cell[1]) || hm.Measured(cell[0], cell[1]) {
+			t.Errorf("filled cell %v is not marked as interpolated", cell)
+		}
+	}
+	if hm.Valid(0, 4) {
+		t.Errorf("the cell at the border was filled")
+	}
+	if hm.IsInterpolated(1, 1) {
+		t.Errorf("a measured cell is marked as interpolated")
+	}
+}
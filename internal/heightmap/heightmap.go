@@ -0,0 +1,607 @@
+package heightmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+)
+
+// HeightMap is the surface of the scanned object, assembled by stacking one
+// height profile per frame. Heights are in mm, cells without a valid
+// measurement are NaN.
+type HeightMap struct {
+	Heights        [][]float64    // indexed by [frame][row]
+	FramePositions []float64      // position of every frame along the feed direction in mm
+	RowSpacing     float64        // distance between two rows in mm
+	RowOffset      float64        // position of row 0 in mm
+	Confidence     [][]float64    // confidence (0 to 1) of every cell, 1 for cells added from plain profiles
+	Colors         [][]color.RGBA // color of every cell sampled from the camera frame, nil if no frames were given
+	Interpolated   [][]bool       // true for cells filled by FillHoles, nil if no hole was filled
+	Lateral        [][]float64    // offset of every cell in mm along the feed direction from where the laser line was seen in the frame, nil if no frame had one, see LateralAt
+	Status         [][]frameprocessor.Status
+	rows           int
+	feedPerFrame   float64
+	colorOffset    int
+	positioner     FramePositioner
+	nextFrame      int // video frame index of the next profile that is added without one
+}
+
+// FramePositioner maps a frame index to its position along the feed direction
+// in mm, e.g. from an encoder log.
+type FramePositioner interface {
+	FramePosition(frame int) (float64, error)
+}
+
+type Options struct {
+	Rows         int     // number of rows per profile, usually the height of the frame
+	FeedPerFrame float64 // distance the object moves between two frames in mm
+	RowSpacing   float64 // distance between two rows in mm, usually 1 / PixelPerMM
+	RowOffset    float64 // position of row 0 in mm
+	ColorOffset  int     // distance in pixel from the laser line at which the colors are sampled, more than half the width of the line
+
+	// Positioner replaces the fixed FeedPerFrame spacing if set
+	Positioner FramePositioner
+}
+
+func NewOptions() Options {
+	return Options{
+		Rows:         0,
+		FeedPerFrame: 1,
+		RowSpacing:   1,
+		RowOffset:    0,
+		ColorOffset:  10,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.Rows < 1 {
+		return fmt.Errorf("Rows needs to be at least 1 but is %d", o.Rows)
+	}
+	if o.FeedPerFrame <= 0 {
+		return fmt.Errorf("FeedPerFrame needs to be greater than 0 but is %f", o.FeedPerFrame)
+	}
+	if o.RowSpacing <= 0 {
+		return fmt.Errorf("RowSpacing needs to be greater than 0 but is %f", o.RowSpacing)
+	}
+	if o.ColorOffset < 1 {
+		return fmt.Errorf("ColorOffset needs to be at least 1 but is %d", o.ColorOffset)
+	}
+
+	return nil
+}
+
+func New(options Options) (*HeightMap, error) {
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	return &HeightMap{
+		Heights:        [][]float64{},
+		FramePositions: []float64{},
+		Confidence:     [][]float64{},
+		Status:         [][]frameprocessor.Status{},
+		RowSpacing:     options.RowSpacing,
+		RowOffset:      options.RowOffset,
+		rows:           options.Rows,
+		feedPerFrame:   options.FeedPerFrame,
+		colorOffset:    options.ColorOffset,
+		positioner:     options.Positioner,
+	}, nil
+}
+
+// AddProfile appends the result of DetermineHeightPerLine as the next frame.
+// It belongs to the video frame after the one of the previous profile, see
+// AddProfileForFrame for how it is positioned. Rows that are missing or
+// negative (no valid measurement) become NaN.
+func (hm *HeightMap) AddProfile(profile map[int]float64) error {
+	return hm.AddProfileForFrame(profile, hm.nextFrame)
+}
+
+// AddProfileForFrame appends a profile that belongs to the given video frame
+// index. Use it instead of AddProfile if not every frame of the video is
+// added. The frame is positioned by the Positioner or, if there is none,
+// placed FeedPerFrame for every video frame after the previous one, so both
+// can be mixed. The frame index has to increase with every profile.
+func (hm *HeightMap) AddProfileForFrame(profile map[int]float64, frame int) error {
+	position, err := hm.framePosition(frame)
+	if err != nil {
+		return err
+	}
+	if err := hm.AddProfileAt(profile, position); err != nil {
+		return err
+	}
+	hm.nextFrame = frame + 1
+
+	return nil
+}
+
+// AddFrameProfile appends the result of DetermineProfile as the next frame,
+// keeping the confidence of every row. If img is not nil the color of every
+// cell is sampled from it between the throughs.
+func (hm *HeightMap) AddFrameProfile(profile frameprocessor.Profile, img image.Image) error {
+	position, err := hm.framePosition(hm.nextFrame)
+	if err != nil {
+		return err
+	}
+
+	return hm.AddFrameProfileAt(profile, img, position)
+}
+
+// AddFrameProfileAt appends the result of DetermineProfile as the next frame
+// at the given position in mm. The status of the rows decides which of them
+// are valid, so negative heights of the single-line mode are kept.
+func (hm *HeightMap) AddFrameProfileAt(profile frameprocessor.Profile, img image.Image, position float64) error {
+	heights := make([]float64, hm.rows)
+	for row := range heights {
+		heights[row] = math.NaN()
+	}
+	confidence := make([]float64, hm.rows)
+	status := make([]frameprocessor.Status, hm.rows)
+	lateral := make([]float64, hm.rows)
+	var colors []color.RGBA
+	if img != nil {
+		colors = make([]color.RGBA, hm.rows)
+	}
+	for _, row := range profile.Rows {
+		if row.Row < 0 || row.Row >= hm.rows {
+			return fmt.Errorf("row %d is outside of the height map (%d rows)", row.Row, hm.rows)
+		}
+		if !row.Status.Valid() {
+			continue
+		}
+		heights[row.Row] = row.Height
+		confidence[row.Row] = row.Confidence
+		lateral[row.Row] = row.Lateral
+		status[row.Row] = row.Status
+		if img != nil {
+			colors[row.Row] = sampleColor(img, row, hm.colorOffset)
+		}
+	}
+
+	hm.appendFrame(heights, position, confidence, status, colors, lateral)
+
+	return nil
+}
+
+// the color is sampled in the middle of the throughs if it is between laser
+// lines that are far enough apart. Otherwise the middle is on the laser, e.g.
+// with a single line, and the color is the mean of both sides next to it.
+func sampleColor(img image.Image, row frameprocessor.RowResult, offset int) color.RGBA {
+	if len(row.Throughs) == 0 {
+		return color.RGBA{}
+	}
+
+	sum, lo, hi := 0, row.Throughs[0], row.Throughs[0]
+	for _, x := range row.Throughs {
+		sum += x
+		lo, hi = min(lo, x), max(hi, x)
+	}
+	middle := sum / len(row.Throughs)
+	onLine := false
+	for _, x := range row.Throughs {
+		onLine = onLine || (middle-x < offset && x-middle < offset)
+	}
+	if !onLine {
+		return color.RGBAModel.Convert(img.At(middle, row.Row)).(color.RGBA)
+	}
+
+	var r, g, b, n uint32
+	bounds := img.Bounds()
+	for _, x := range []int{lo - offset, hi + offset} {
+		if x < bounds.Min.X || x >= bounds.Max.X {
+			continue
+		}
+		c := color.RGBAModel.Convert(img.At(x, row.Row)).(color.RGBA)
+		r, g, b, n = r+uint32(c.R), g+uint32(c.G), b+uint32(c.B), n+1
+	}
+	if n == 0 {
+		return color.RGBA{}
+	}
+
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255}
+}
+
+// AddProfileAt appends a profile as the next frame at the given position in mm.
+func (hm *HeightMap) AddProfileAt(profile map[int]float64, position float64) error {
+	heights, err := hm.heightsFromProfile(profile)
+	if err != nil {
+		return err
+	}
+
+	// DetermineHeightPerLine reports exactly 0 for rows with a single through
+	status := make([]frameprocessor.Status, hm.rows)
+	for row, height := range heights {
+		switch {
+		case height == 0:
+			status[row] = frameprocessor.StatusGround
+		case !math.IsNaN(height):
+			status[row] = frameprocessor.StatusMeasured
+		}
+	}
+
+	hm.appendFrame(heights, position, validConfidence(heights), status, nil, nil)
+
+	return nil
+}
+
+// AddHeightsAt appends a frame of heights at the given position in mm. Unlike
+// profiles the heights may be negative, cells without a measurement are NaN.
+func (hm *HeightMap) AddHeightsAt(heights []float64, position float64) error {
+	if len(heights) != hm.rows {
+		return fmt.Errorf("got %d heights but the height map has %d rows", len(heights), hm.rows)
+	}
+
+	frame := make([]float64, hm.rows)
+	copy(frame, heights)
+	status := make([]frameprocessor.Status, hm.rows)
+	for row, height := range frame {
+		if !math.IsNaN(height) {
+			status[row] = frameprocessor.StatusMeasured
+		}
+	}
+
+	hm.appendFrame(frame, position, validConfidence(frame), status, nil, nil)
+
+	return nil
+}
+
+func (hm *HeightMap) heightsFromProfile(profile map[int]float64) ([]float64, error) {
+	heights := make([]float64, hm.rows)
+	for row := range heights {
+		heights[row] = math.NaN()
+	}
+
+	for row, height := range profile {
+		if row < 0 || row >= hm.rows {
+			return nil, fmt.Errorf("row %d is outside of the height map (%d rows)", row, hm.rows)
+		}
+		if height < 0 {
+			continue
+		}
+		heights[row] = height
+	}
+
+	return heights, nil
+}
+
+// colors and lateral offsets are only kept once the first frame with them was
+// added, frames without them get black cells and no offset
+func (hm *HeightMap) appendFrame(heights []float64, position float64, confidence []float64, status []frameprocessor.Status, colors []color.RGBA, lateral []float64) {
+	if colors != nil && hm.Colors == nil {
+		hm.Colors = make([][]color.RGBA, len(hm.Heights))
+		for frame := range hm.Colors {
+			hm.Colors[frame] = make([]color.RGBA, hm.rows)
+		}
+	}
+	if colors == nil && hm.Colors != nil {
+		colors = make([]color.RGBA, hm.rows)
+	}
+	if lateral != nil && hm.Lateral == nil {
+		hm.Lateral = make([][]float64, len(hm.Heights))
+		for frame := range hm.Lateral {
+			hm.Lateral[frame] = make([]float64, hm.rows)
+		}
+	}
+	if lateral == nil && hm.Lateral != nil {
+		lateral = make([]float64, hm.rows)
+	}
+
+	hm.Heights = append(hm.Heights, heights)
+	hm.nextFrame++
+	hm.FramePositions = append(hm.FramePositions, position)
+	hm.Confidence = append(hm.Confidence, confidence)
+	hm.Status = append(hm.Status, status)
+	if hm.Colors != nil {
+		hm.Colors = append(hm.Colors, colors)
+	}
+	if hm.Lateral != nil {
+		hm.Lateral = append(hm.Lateral, lateral)
+	}
+	if hm.Interpolated != nil {
+		hm.Interpolated = append(hm.Interpolated, make([]bool, hm.rows))
+	}
+}
+
+// plain profiles carry no confidence, so every valid cell is fully trusted
+func validConfidence(heights []float64) []float64 {
+	confidence := make([]float64, len(heights))
+	for row, height := range heights {
+		if !math.IsNaN(height) {
+			confidence[row] = 1
+		}
+	}
+
+	return confidence
+}
+
+// StatusAt returns how the height of a cell was determined.
+func (hm *HeightMap) StatusAt(frame int, row int) frameprocessor.Status {
+	if !hm.Valid(frame, row) {
+		return frameprocessor.StatusInvalid
+	}
+
+	return hm.Status[frame][row]
+}
+
+// LateralAt returns how far the measurement of a cell is off the frame
+// position along the feed direction in mm, 0 if it is not known. The gridded
+// operations like HeightAt and CellAt place every cell at the position of its
+// frame, ResampleLateral moves the measurements there.
+func (hm *HeightMap) LateralAt(frame int, row int) float64 {
+	if hm.Lateral == nil || !hm.Valid(frame, row) {
+		return 0
+	}
+
+	return hm.Lateral[frame][row]
+}
+
+// PointAt returns the position of a cell in mm including its lateral offset.
+func (hm *HeightMap) PointAt(frame int, row int) (x float64, y float64, z float64) {
+	return hm.FrameToMM(frame) + hm.LateralAt(frame, row), hm.RowToMM(row), hm.At(frame, row)
+}
+
+// ResampleLateral moves the measurements from where the laser line was seen
+// onto the grid of the frames. Every valid cell gets the height of its row
+// interpolated linearly at the frame position between the closest
+// measurements on both sides, cells at the ends of a row or next to a gap of
+// more than two frame widths keep their height. Lateral is nil afterwards.
+func (hm *HeightMap) ResampleLateral() {
+	if hm.Lateral == nil {
+		return
+	}
+
+	type sample struct{ x, h float64 }
+	for row := range hm.rows {
+		samples := []sample{}
+		for frame := range hm.Heights {
+			if hm.Valid(frame, row) {
+				x, _, h := hm.PointAt(frame, row)
+				samples = append(samples, sample{x: x, h: h})
+			}
+		}
+		sort.Slice(samples, func(a, b int) bool { return samples[a].x < samples[b].x })
+
+		for frame := range hm.Heights {
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			x := hm.FrameToMM(frame)
+			i := sort.Search(len(samples), func(i int) bool { return samples[i].x >= x })
+			switch {
+			case i < len(samples) && samples[i].x == x:
+				hm.Heights[frame][row] = samples[i].h
+			case i == 0 || i == len(samples):
+			case samples[i].x-samples[i-1].x > 2*hm.FrameWidth(frame):
+			default:
+				a, b := samples[i-1], samples[i]
+				hm.Heights[frame][row] = a.h + (b.h-a.h)*(x-a.x)/(b.x-a.x)
+			}
+		}
+	}
+	hm.Lateral = nil
+}
+
+// ConfidenceAt returns the confidence of a cell, 0 for invalid cells.
+func (hm *HeightMap) ConfidenceAt(frame int, row int) float64 {
+	if !hm.Valid(frame, row) {
+		return 0
+	}
+
+	return hm.Confidence[frame][row]
+}
+
+// framePosition is the position of the given video frame, the last added
+// frame is taken to belong to the video frame before nextFrame.
+func (hm *HeightMap) framePosition(frame int) (float64, error) {
+	if frame < hm.nextFrame {
+		return 0, fmt.Errorf("frame %d is not after the previous frame %d", frame, hm.nextFrame-1)
+	}
+	if hm.positioner != nil {
+		position, err := hm.positioner.FramePosition(frame)
+		if err != nil {
+			return 0, fmt.Errorf("failed to determine position of frame %d: %w", frame, err)
+		}
+		return position, nil
+	}
+	if len(hm.FramePositions) == 0 {
+		return float64(frame) * hm.feedPerFrame, nil
+	}
+
+	return hm.FramePositions[len(hm.FramePositions)-1] + float64(frame-hm.nextFrame+1)*hm.feedPerFrame, nil
+}
+
+func (hm *HeightMap) Frames() int {
+	return len(hm.Heights)
+}
+
+func (hm *HeightMap) Rows() int {
+	return hm.rows
+}
+
+// At returns the height at the given cell or NaN if the cell has no valid measurement.
+func (hm *HeightMap) At(frame int, row int) float64 {
+	if frame < 0 || frame >= len(hm.Heights) || row < 0 || row >= hm.rows {
+		return math.NaN()
+	}
+
+	return hm.Heights[frame][row]
+}
+
+func (hm *HeightMap) Valid(frame int, row int) bool {
+	return !math.IsNaN(hm.At(frame, row))
+}
+
+// Mask returns a grid that is true for every cell with a valid measurement.
+func (hm *HeightMap) Mask() [][]bool {
+	mask := make([][]bool, len(hm.Heights))
+	for frame := range hm.Heights {
+		mask[frame] = make([]bool, hm.rows)
+		for row := range hm.rows {
+			mask[frame][row] = hm.Valid(frame, row)
+		}
+	}
+
+	return mask
+}
+
+// FrameToMM returns the position of a frame along the feed direction in mm.
+func (hm *HeightMap) FrameToMM(frame int) float64 {
+	return hm.FramePositions[frame]
+}
+
+// RowToMM returns the position of a row along the laser line in mm.
+func (hm *HeightMap) RowToMM(row int) float64 {
+	return hm.RowOffset + float64(row)*hm.RowSpacing
+}
+
+// FrameWidth returns the distance along the feed direction in mm that a frame
+// covers, which is half the distance to each of its neighbours.
+func (hm *HeightMap) FrameWidth(frame int) float64 {
+	if len(hm.FramePositions) < 2 {
+		return math.Abs(hm.feedPerFrame)
+	}
+
+	first := max(frame-1, 0)
+	last := min(frame+1, len(hm.FramePositions)-1)
+
+	return math.Abs(hm.FramePositions[last]-hm.FramePositions[first]) / float64(last-first)
+}
+
+// CellArea returns the area in mm² that a cell covers on the plate.
+func (hm *HeightMap) CellArea(frame int) float64 {
+	return hm.FrameWidth(frame) * math.Abs(hm.RowSpacing)
+}
+
+// Range returns the lowest and highest valid height. ok is false if the height
+// map has no valid cells.
+func (hm *HeightMap) Range() (lo float64, hi float64, ok bool) {
+	lo = math.Inf(1)
+	hi = math.Inf(-1)
+	for _, heights := range hm.Heights {
+		for _, h := range heights {
+			if math.IsNaN(h) {
+				continue
+			}
+			lo = min(lo, h)
+			hi = max(hi, h)
+		}
+	}
+
+	return lo, hi, !math.IsInf(lo, 1)
+}
+
+// Bounds returns the area covered by the height map in mm.
+func (hm *HeightMap) Bounds() (minX float64, minY float64, maxX float64, maxY float64) {
+	minX, maxX = math.Inf(1), math.Inf(-1)
+	for _, position := range hm.FramePositions {
+		minX = math.Min(minX, position)
+		maxX = math.Max(maxX, position)
+	}
+	minY = math.Min(hm.RowToMM(0), hm.RowToMM(hm.rows-1))
+	maxY = math.Max(hm.RowToMM(0), hm.RowToMM(hm.rows-1))
+
+	return minX, minY, maxX, maxY
+}
+
+// HeightAt interpolates the height at the given position in mm bilinearly
+// between the four surrounding cells. It returns NaN if the position is
+// outside of the height map or one of the surrounding cells is invalid.
+// The frames need to be sorted by their position, either ascending or
+// descending.
+func (hm *HeightMap) HeightAt(x float64, y float64) float64 {
+	frame, frameFactor, ok := hm.frameBracket(x)
+	if !ok {
+		return math.NaN()
+	}
+
+	rowPosition := (y - hm.RowOffset) / hm.RowSpacing
+	if rowPosition < 0 || rowPosition > float64(hm.rows-1) {
+		return math.NaN()
+	}
+	row := int(rowPosition)
+	if row == hm.rows-1 {
+		row--
+	}
+	rowFactor := rowPosition - float64(row)
+	if hm.rows == 1 {
+		row, rowFactor = 0, 0
+	}
+
+	height := 0.0
+	for _, corner := range []struct {
+		frame, row int
+		weight     float64
+	}{
+		{frame: frame, row: row, weight: (1 - frameFactor) * (1 - rowFactor)},
+		{frame: frame + 1, row: row, weight: frameFactor * (1 - rowFactor)},
+		{frame: frame, row: row + 1, weight: (1 - frameFactor) * rowFactor},
+		{frame: frame + 1, row: row + 1, weight: frameFactor * rowFactor},
+	} {
+		// cells with a weight of 0 may be invalid or outside
+		if corner.weight == 0 {
+			continue
+		}
+		height += corner.weight * hm.At(corner.frame, corner.row)
+	}
+
+	return height
+}
+
+// CellAt returns the cell closest to the given position in mm. ok is false if
+// the position is outside of the height map.
+func (hm *HeightMap) CellAt(x float64, y float64) (frame int, row int, ok bool) {
+	frame, frameFactor, ok := hm.frameBracket(x)
+	if !ok {
+		return 0, 0, false
+	}
+	if frameFactor > 0.5 {
+		frame++
+	}
+
+	rowPosition := (y - hm.RowOffset) / hm.RowSpacing
+	if rowPosition < -0.5 || rowPosition > float64(hm.rows)-0.5 {
+		return 0, 0, false
+	}
+
+	return frame, min(int(math.Round(rowPosition)), hm.rows-1), true
+}
+
+// returns the frame before the position and how far the position is towards
+// the next frame
+func (hm *HeightMap) frameBracket(x float64) (int, float64, bool) {
+	n := len(hm.FramePositions)
+	if n == 0 {
+		return 0, 0, false
+	}
+	if n == 1 {
+		return 0, 0, x == hm.FramePositions[0]
+	}
+
+	ascending := hm.FramePositions[n-1] >= hm.FramePositions[0]
+	i := sort.Search(n, func(i int) bool {
+		if ascending {
+			return hm.FramePositions[i] >= x
+		}
+
+		return hm.FramePositions[i] <= x
+	})
+	if i == n {
+		return 0, 0, false
+	}
+	if hm.FramePositions[i] == x {
+		if i == n-1 {
+			return i - 1, 1, true
+		}
+
+		return i, 0, true
+	}
+	if i == 0 {
+		return 0, 0, false
+	}
+
+	return i - 1, (x - hm.FramePositions[i-1]) / (hm.FramePositions[i] - hm.FramePositions[i-1]), true
+}
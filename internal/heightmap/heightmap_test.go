@@ -0,0 +1,347 @@
+package heightmap
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+)
+
+func TestAddProfile(t *testing.T) {
+	options := NewOptions()
+	options.Rows = 3
+	options.FeedPerFrame = 0.5
+	options.RowSpacing = 0.1
+
+	hm, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, profile := range []map[int]float64{
+		{0: 0, 1: 2, 2: -1},
+		{0: 1, 2: 4},
+	} {
+		if err := hm.AddProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if hm.Frames() != 2 {
+		t.Fatalf("Frames() = %d, want 2", hm.Frames())
+	}
+
+	tests := []struct {
+		frame int
+		row   int
+		want  float64
+	}{
+		{frame: 0, row: 0, want: 0},
+		{frame: 0, row: 1, want: 2},
+		{frame: 0, row: 2, want: math.NaN()},
+		{frame: 1, row: 0, want: 1},
+		{frame: 1, row: 1, want: math.NaN()},
+		{frame: 1, row: 2, want: 4},
+	}
+	for _, tt := range tests {
+		got := hm.At(tt.frame, tt.row)
+		if math.IsNaN(tt.want) != math.IsNaN(got) || (!math.IsNaN(got) && got != tt.want) {
+			t.Errorf("At(%d, %d) = %f, want %f", tt.frame, tt.row, got, tt.want)
+		}
+		if valid := hm.Valid(tt.frame, tt.row); valid == math.IsNaN(tt.want) {
+			t.Errorf("Valid(%d, %d) = %v, want %v", tt.frame, tt.row, valid, !valid)
+		}
+	}
+
+	if hm.FrameToMM(1) != 0.5 {
+		t.Errorf("FrameToMM(1) = %f, want 0.5", hm.FrameToMM(1))
+	}
+	if math.Abs(hm.RowToMM(2)-0.2) > 1e-9 {
+		t.Errorf("RowToMM(2) = %f, want 0.2", hm.RowToMM(2))
+	}
+
+	if err := hm.AddProfile(map[int]float64{3: 1}); err == nil {
+		t.Errorf("AddProfile() with row outside of the height map should fail")
+	}
+}
+
+// squarePositioner places frame i at i*i mm
+type squarePositioner struct{}
+
+func (squarePositioner) FramePosition(frame int) (float64, error) {
+	return float64(frame * frame), nil
+}
+
+func TestAddProfileForFrame(t *testing.T) {
+	tests := []struct {
+		name       string
+		positioner FramePositioner
+		frames     []int // video frame of every profile, -1 adds it with AddProfile
+		want       []float64
+	}{
+		{name: "sequential", frames: []int{-1, -1, -1}, want: []float64{0, 0.5, 1}},
+		{name: "skipped frames", frames: []int{2, 5, 6}, want: []float64{1, 2.5, 3}},
+		{name: "mixed", frames: []int{-1, 3, -1, 6, -1}, want: []float64{0, 1.5, 2, 3, 3.5}},
+		{name: "positioner", positioner: squarePositioner{}, frames: []int{-1, 3, -1}, want: []float64{0, 9, 16}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewOptions()
+			options.Rows = 1
+			options.FeedPerFrame = 0.5
+			options.Positioner = tt.positioner
+			hm, err := New(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, frame := range tt.frames {
+				if frame < 0 {
+					err = hm.AddProfile(map[int]float64{0: 1})
+				} else {
+					err = hm.AddProfileForFrame(map[int]float64{0: 1}, frame)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for frame, want := range tt.want {
+				if got := hm.FrameToMM(frame); math.Abs(got-want) > 1e-9 {
+					t.Errorf("FrameToMM(%d) = %f, want %f", frame, got, want)
+				}
+			}
+		})
+	}
+
+	options := NewOptions()
+	options.Rows = 1
+	hm, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.AddProfileForFrame(map[int]float64{0: 1}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.AddProfileForFrame(map[int]float64{0: 1}, 4); err == nil {
+		t.Errorf("AddProfileForFrame() with a frame that is not after the previous one should fail")
+	}
+}
+
+func TestColors(t *testing.T) {
+	// a blue part with red laser pixels at the columns 5 and 25 of row 0 and
+	// at column 5 of row 1
+	part := color.RGBA{B: 200, A: 255}
+	laser := color.RGBA{R: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 30, 2))
+	for x := range 30 {
+		for y := range 2 {
+			img.SetRGBA(x, y, part)
+		}
+	}
+	img.SetRGBA(5, 0, laser)
+	img.SetRGBA(25, 0, laser)
+	img.SetRGBA(5, 1, laser)
+
+	options := NewOptions()
+	options.Rows = 2
+	options.ColorOffset = 3
+	hm, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := frameprocessor.Profile{Rows: []frameprocessor.RowResult{
+		{Row: 0, Throughs: []int{5, 25}, Height: 2, Status: frameprocessor.StatusMeasured},
+		{Row: 1, Throughs: []int{5}, Height: 0, Status: frameprocessor.StatusGround},
+	}}
+	if err := hm.AddFrameProfileAt(profile, img, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for row, name := range []string{"between the lines", "next to a single line"} {
+		if got := hm.Colors[0][row]; got != part {
+			t.Errorf("color %s = %v, want %v", name, got, part)
+		}
+	}
+}
+
+func TestHeightAt(t *testing.T) {
+	options := NewOptions()
+	options.Rows = 3
+	options.FeedPerFrame = 2
+	hm, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range []map[int]float64{
+		{0: 0, 1: 2, 2: -1},
+		{0: 4, 1: 6, 2: 8},
+	} {
+		if err := hm.AddProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		x, y float64
+		want float64
+	}{
+		{name: "on a cell", x: 0, y: 1, want: 2},
+		{name: "between frames", x: 1, y: 0, want: 2},
+		{name: "between frames and rows", x: 1, y: 0.5, want: 3},
+		{name: "last frame and row", x: 2, y: 2, want: 8},
+		{name: "next to an invalid cell", x: 1, y: 1.5, want: math.NaN()},
+		{name: "outside", x: 3, y: 0, want: math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hm.HeightAt(tt.x, tt.y)
+			if math.IsNaN(tt.want) != math.IsNaN(got) || (!math.IsNaN(got) && math.Abs(got-tt.want) > 1e-9) {
+				t.Errorf("HeightAt(%f, %f) = %f, want %f", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPointAt(t *testing.T) {
+	options := NewOptions()
+	options.Rows = 2
+	options.FeedPerFrame = 0.5
+	options.RowSpacing = 0.1
+
+	hm, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hm.AddProfile(map[int]float64{0: 1, 1: 2}); err != nil {
+		t.Fatal(err)
+	}
+	profile := frameprocessor.Profile{Rows: []frameprocessor.RowResult{
+		{Row: 0, Height: 3, Status: frameprocessor.StatusMeasured, Lateral: 0.25},
+		{Row: 1, Height: 4, Status: frameprocessor.StatusInvalid, Lateral: 0.25},
+	}}
+	if err := hm.AddFrameProfileAt(profile, nil, 0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		frame   int
+		row     int
+		x, y, z float64
+	}{
+		{frame: 0, row: 0, x: 0, y: 0, z: 1}, // frame without lateral positions
+		{frame: 1, row: 0, x: 0.75, y: 0, z: 3},
+	}
+	for _, tt := range tests {
+		x, y, z := hm.PointAt(tt.frame, tt.row)
+		if x != tt.x || y != tt.y || z != tt.z {
+			t.Errorf("PointAt(%d, %d) = %f, %f, %f, want %f, %f, %f", tt.frame, tt.row, x, y, z, tt.x, tt.y, tt.z)
+		}
+	}
+	if hm.Valid(1, 1) || hm.LateralAt(1, 1) != 0 {
+		t.Errorf("the invalid row should have no lateral position, got %f", hm.LateralAt(1, 1))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := hm.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LateralAt(1, 0) != 0.25 {
+		t.Errorf("LateralAt(1, 0) after Read() = %f, want 0.25", got.LateralAt(1, 0))
+	}
+}
+
+func TestResampleLateral(t *testing.T) {
+	options := NewOptions()
+	options.Rows = 2
+	hm, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a slope of 1mm per mm along X, every line was seen 0.5mm after its
+	// frame position and row 1 has a gap in frame 2
+	for frame := range 5 {
+		x := float64(frame) + 0.5
+		profile := frameprocessor.Profile{Rows: []frameprocessor.RowResult{
+			{Row: 0, Height: x, Status: frameprocessor.StatusMeasured, Lateral: 0.5},
+			{Row: 1, Height: x, Status: frameprocessor.StatusMeasured, Lateral: 0.5},
+		}}
+		if frame == 2 {
+			profile.Rows[1].Status = frameprocessor.StatusInvalid
+		}
+		if err := hm.AddFrameProfileAt(profile, nil, float64(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hm.ResampleLateral()
+	if hm.Lateral != nil {
+		t.Errorf("ResampleLateral() kept the lateral offsets")
+	}
+	tests := []struct {
+		frame, row int
+		want       float64
+	}{
+		{frame: 0, row: 0, want: 0.5}, // no measurement before the first frame
+		{frame: 1, row: 0, want: 1},
+		{frame: 4, row: 0, want: 4},
+		{frame: 1, row: 1, want: 1},
+		{frame: 3, row: 1, want: 3}, // interpolated across the gap of frame 2
+	}
+	for _, tt := range tests {
+		if got := hm.At(tt.frame, tt.row); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("At(%d, %d) = %f, want %f", tt.frame, tt.row, got, tt.want)
+		}
+	}
+	if hm.Valid(2, 1) {
+		t.Errorf("ResampleLateral() filled the invalid cell")
+	}
+	if got := hm.HeightAt(2.5, 0); math.Abs(got-2.5) > 1e-9 {
+		t.Errorf("HeightAt(2.5, 0) = %f, want 2.5", got)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	hm := newSlope(t)
+	hm.Heights[1][2] = math.NaN()
+	hm.Heights[3][3] = math.NaN()
+	if filled := hm.FillHoles(1); filled != 2 {
+		t.Fatalf("FillHoles() = %d, want 2", filled)
+	}
+	hm.Heights[0][4] = math.NaN()
+	hm.Status[0][0] = frameprocessor.StatusGround
+
+	buf := &bytes.Buffer{}
+	if err := hm.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Frames() != hm.Frames() || got.Rows() != hm.Rows() {
+		t.Fatalf("Read() has %d x %d cells, want %d x %d", got.Frames(), got.Rows(), hm.Frames(), hm.Rows())
+	}
+	for frame := range hm.Frames() {
+		if got.FrameToMM(frame) != hm.FrameToMM(frame) {
+			t.Errorf("frame %d is at %f, want %f", frame, got.FrameToMM(frame), hm.FrameToMM(frame))
+		}
+		for row := range hm.Rows() {
+			if got.Valid(frame, row) != hm.Valid(frame, row) || (hm.Valid(frame, row) && got.At(frame, row) != hm.At(frame, row)) {
+				t.Errorf("cell %d,%d = %f, want %f", frame, row, got.At(frame, row), hm.At(frame, row))
+			}
+			if got.StatusAt(frame, row) != hm.StatusAt(frame, row) || got.IsInterpolated(frame, row) != hm.IsInterpolated(frame, row) {
+				t.Errorf("cell %d,%d is %s and interpolated %v, want %s and %v", frame, row, got.StatusAt(frame, row), got.IsInterpolated(frame, row), hm.StatusAt(frame, row), hm.IsInterpolated(frame, row))
+			}
+		}
+	}
+}
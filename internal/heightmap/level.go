@@ -0,0 +1,208 @@
+package heightmap
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/Neokil/ltp/internal/linalg"
+)
+
+// Plane is z = A*x + B*y + C in mm.
+type Plane struct {
+	A, B, C float64
+}
+
+func (p Plane) At(x float64, y float64) float64 {
+	return p.A*x + p.B*y + p.C
+}
+
+// TiltDegrees returns the angle between the plane and the XY plane.
+func (p Plane) TiltDegrees() float64 {
+	return math.Atan(math.Hypot(p.A, p.B)) * 180 / math.Pi
+}
+
+// TiltXDegrees returns the tilt along the feed direction.
+func (p Plane) TiltXDegrees() float64 {
+	return math.Atan(p.A) * 180 / math.Pi
+}
+
+// TiltYDegrees returns the tilt along the laser line.
+func (p Plane) TiltYDegrees() float64 {
+	return math.Atan(p.B) * 180 / math.Pi
+}
+
+type LevelOptions struct {
+	MaxGroundHeight  float64 // height in mm up to which cells are candidates for the plate
+	InlierDistance   float64 // maximum distance in mm of a point to the plane to count as inlier
+	Iterations       int     // number of RANSAC iterations
+	MinInlierPercent float64 // minimum share of the candidates that have to support the plane
+	Seed             int64   // seed of the random sampling, so the results are reproducible
+}
+
+func NewLevelOptions() LevelOptions {
+	return LevelOptions{
+		MaxGroundHeight:  0.5,
+		InlierDistance:   0.05,
+		Iterations:       500,
+		MinInlierPercent: 30,
+		Seed:             1,
+	}
+}
+
+func (o LevelOptions) Validate() error {
+	if o.MaxGroundHeight < 0 {
+		return fmt.Errorf("MaxGroundHeight needs to be at least 0 but is %f", o.MaxGroundHeight)
+	}
+	if o.InlierDistance <= 0 {
+		return fmt.Errorf("InlierDistance needs to be greater than 0 but is %f", o.InlierDistance)
+	}
+	if o.Iterations < 1 {
+		return fmt.Errorf("Iterations needs to be at least 1 but is %d", o.Iterations)
+	}
+	if o.MinInlierPercent < 0 || o.MinInlierPercent > 100 {
+		return fmt.Errorf("MinInlierPercent needs to be between 0 and 100 but is %f", o.MinInlierPercent)
+	}
+
+	return nil
+}
+
+// LevelResult describes the plane that was removed by Level.
+type LevelResult struct {
+	Plane      Plane
+	Candidates int // number of ground cells the plane was fitted to
+	Inliers    int // number of ground cells that support the plane
+}
+
+// returns the position of every measured cell within the plate band
+func (hm *HeightMap) groundCandidates(maxHeight float64) [][3]float64 {
+	candidates := [][3]float64{}
+	for frame := range hm.Heights {
+		for row := range hm.rows {
+			if hm.Measured(frame, row) && math.Abs(hm.At(frame, row)) <= maxHeight {
+				candidates = append(candidates, [3]float64{hm.FrameToMM(frame), hm.RowToMM(row), hm.At(frame, row)})
+			}
+		}
+	}
+
+	return candidates
+}
+
+// FitGroundPlane fits a plane to the cells up to MaxGroundHeight using RANSAC,
+// so low objects within the band are ignored. Cells with StatusGround are
+// always 0, as the lines meet there, so the tilt of the plate is only seen in
+// the measured cells next to them and both are candidates.
+func (hm *HeightMap) FitGroundPlane(options LevelOptions) (LevelResult, error) {
+	if err := options.Validate(); err != nil {
+		return LevelResult{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	candidates := hm.groundCandidates(options.MaxGroundHeight)
+	if len(candidates) < 3 {
+		return LevelResult{}, fmt.Errorf("need at least 3 ground cells to fit a plane but found %d", len(candidates))
+	}
+
+	random := rand.New(rand.NewSource(options.Seed))
+	bestInliers := []([3]float64){}
+	for range options.Iterations {
+		a := candidates[random.Intn(len(candidates))]
+		b := candidates[random.Intn(len(candidates))]
+		c := candidates[random.Intn(len(candidates))]
+		plane, ok := planeThroughPoints(a, b, c)
+		if !ok {
+			continue
+		}
+
+		inliers := [][3]float64{}
+		for _, p := range candidates {
+			if math.Abs(p[2]-plane.At(p[0], p[1])) <= options.InlierDistance {
+				inliers = append(inliers, p)
+			}
+		}
+		if len(inliers) > len(bestInliers) {
+			bestInliers = inliers
+		}
+	}
+
+	if len(bestInliers) == 0 {
+		return LevelResult{}, fmt.Errorf("the %d ground cells are collinear, can not fit a plane", len(candidates))
+	}
+	if float64(len(bestInliers)) < float64(len(candidates))*options.MinInlierPercent/100 || len(bestInliers) < 3 {
+		return LevelResult{}, fmt.Errorf("only %d of %d ground cells support the best plane", len(bestInliers), len(candidates))
+	}
+
+	plane, err := FitPlane(bestInliers)
+	if err != nil {
+		return LevelResult{}, fmt.Errorf("failed to fit ground plane: %w", err)
+	}
+
+	return LevelResult{Plane: plane, Candidates: len(candidates), Inliers: len(bestInliers)}, nil
+}
+
+// SubtractPlane removes the plane from every valid cell.
+func (hm *HeightMap) SubtractPlane(plane Plane) {
+	for frame := range hm.Heights {
+		for row := range hm.rows {
+			if hm.Valid(frame, row) {
+				hm.Heights[frame][row] -= plane.At(hm.FrameToMM(frame), hm.RowToMM(row))
+			}
+		}
+	}
+}
+
+// Level fits the ground plane and subtracts it, so heights are measured
+// against the plate even if it is tilted.
+func (hm *HeightMap) Level(options LevelOptions) (LevelResult, error) {
+	result, err := hm.FitGroundPlane(options)
+	if err != nil {
+		return LevelResult{}, err
+	}
+	hm.SubtractPlane(result.Plane)
+
+	return result, nil
+}
+
+func planeThroughPoints(a, b, c [3]float64) (Plane, bool) {
+	// normal of the plane is (b-a) x (c-a)
+	u := [3]float64{b[0] - a[0], b[1] - a[1], b[2] - a[2]}
+	v := [3]float64{c[0] - a[0], c[1] - a[1], c[2] - a[2]}
+	nx := u[1]*v[2] - u[2]*v[1]
+	ny := u[2]*v[0] - u[0]*v[2]
+	nz := u[0]*v[1] - u[1]*v[0]
+	if math.Abs(nz) < 1e-12 {
+		// collinear or vertical
+		return Plane{}, false
+	}
+
+	p := Plane{A: -nx / nz, B: -ny / nz}
+	p.C = a[2] - p.A*a[0] - p.B*a[1]
+
+	return p, true
+}
+
+// FitPlane fits a plane to the (x, y, z) points by least squares.
+func FitPlane(points [][3]float64) (Plane, error) {
+	var sxx, sxy, sx, syy, sy, n, sxz, syz, sz float64
+	for _, p := range points {
+		x, y, z := p[0], p[1], p[2]
+		sxx += x * x
+		sxy += x * y
+		sx += x
+		syy += y * y
+		sy += y
+		n++
+		sxz += x * z
+		syz += y * z
+		sz += z
+	}
+
+	solution, ok := linalg.Solve(
+		[][]float64{{sxx, sxy, sx}, {sxy, syy, sy}, {sx, sy, n}},
+		[]float64{sxz, syz, sz},
+	)
+	if !ok {
+		return Plane{}, fmt.Errorf("the %d points are collinear, can not fit a plane", len(points))
+	}
+
+	return Plane{A: solution[0], B: solution[1], C: solution[2]}, nil
+}
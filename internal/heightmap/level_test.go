@@ -0,0 +1,126 @@
+package heightmap
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+)
+
+func TestLevel(t *testing.T) {
+	options := NewOptions()
+	options.Rows = 10
+	hm, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// plate tilted by 0.01mm per mm along both axes, with a 5mm high object
+	tilt := Plane{A: 0.01, B: 0.01, C: 0}
+	for frame := range 10 {
+		heights := make([]float64, 10)
+		for row := range heights {
+			heights[row] = tilt.At(float64(frame), float64(row))
+			if frame >= 3 && frame < 6 && row >= 3 && row < 6 {
+				heights[row] += 5
+			}
+		}
+		if err := hm.AddHeightsAt(heights, float64(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := hm.Level(NewLevelOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(result.Plane.A-tilt.A) > 1e-9 || math.Abs(result.Plane.B-tilt.B) > 1e-9 || math.Abs(result.Plane.C) > 1e-9 {
+		t.Errorf("Level() found plane %+v, want %+v", result.Plane, tilt)
+	}
+	if result.Inliers != 100-9 {
+		t.Errorf("Level() has %d inliers, want %d", result.Inliers, 100-9)
+	}
+	if want := math.Atan(math.Hypot(0.01, 0.01)) * 180 / math.Pi; math.Abs(result.Plane.TiltDegrees()-want) > 1e-9 {
+		t.Errorf("TiltDegrees() = %f, want %f", result.Plane.TiltDegrees(), want)
+	}
+
+	if h := hm.At(9, 9); math.Abs(h) > 1e-9 {
+		t.Errorf("leveled plate at 9,9 = %f, want 0", h)
+	}
+	if h := hm.At(4, 4); math.Abs(h-5) > 1e-9 {
+		t.Errorf("leveled object at 4,4 = %f, want 5", h)
+	}
+}
+
+func TestLevelProfiles(t *testing.T) {
+	// plate rising by 0.01mm per mm along both axes, with a 0.2mm high glue bead
+	// in the frames 3 to 5 and a 5mm high object
+	tilt := Plane{A: 0.01, B: 0.01, C: 0}
+	height := func(frame int, row int) float64 {
+		h := tilt.At(float64(frame), float64(row))
+		if frame >= 3 && frame < 6 {
+			h += 0.2
+		}
+		if frame >= 7 && row >= 6 {
+			h += 5
+		}
+		return h
+	}
+
+	tests := []struct {
+		name string
+		row  func(frame int, row int) frameprocessor.RowResult
+	}{
+		{
+			// the lines meet where the plate is within a pixel of the
+			// calibrated plate, those rows are ground at 0
+			name: "dual-line",
+			row: func(frame int, row int) frameprocessor.RowResult {
+				h := height(frame, row)
+				if h < 0.03 {
+					return frameprocessor.RowResult{Row: row, Height: 0, Status: frameprocessor.StatusGround}
+				}
+				return frameprocessor.RowResult{Row: row, Height: h, Status: frameprocessor.StatusMeasured}
+			},
+		},
+		{
+			name: "single-line",
+			row: func(frame int, row int) frameprocessor.RowResult {
+				return frameprocessor.RowResult{Row: row, Height: height(frame, row), Status: frameprocessor.StatusMeasured}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewOptions()
+			options.Rows = 10
+			hm, err := New(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for frame := range 10 {
+				profile := frameprocessor.Profile{}
+				for row := range 10 {
+					profile.Rows = append(profile.Rows, tt.row(frame, row))
+				}
+				if err := hm.AddFrameProfileAt(profile, nil, float64(frame)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := hm.Level(NewLevelOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(result.Plane.A-tilt.A) > 0.002 || math.Abs(result.Plane.B-tilt.B) > 0.002 || math.Abs(result.Plane.C) > 0.02 {
+				t.Errorf("Level() found plane %+v, want %+v", result.Plane, tilt)
+			}
+			if h := hm.At(4, 4); math.Abs(h-0.2) > 0.03 {
+				t.Errorf("leveled glue bead at 4,4 = %f, want 0.2", h)
+			}
+			if h := hm.At(9, 9); math.Abs(h-5) > 0.03 {
+				t.Errorf("leveled object at 9,9 = %f, want 5", h)
+			}
+		})
+	}
+}
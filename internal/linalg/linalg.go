@@ -0,0 +1,44 @@
+package linalg
+
+import "math"
+
+// Solve solves m * x = v by gaussian elimination with partial pivoting. m and
+// v are left unchanged. It returns false if m is singular.
+func Solve(m [][]float64, v []float64) ([]float64, bool) {
+	n := len(v)
+	a := make([][]float64, n)
+	for i := range m {
+		a[i] = append(append([]float64{}, m[i]...), v[i])
+	}
+
+	for col := range n {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for c := col; c <= n; c++ {
+				a[row][c] -= f * a[col][c]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := a[row][n]
+		for c := row + 1; c < n; c++ {
+			sum -= a[row][c] * x[c]
+		}
+		x[row] = sum / a[row][row]
+	}
+
+	return x, true
+}
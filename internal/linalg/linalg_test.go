@@ -0,0 +1,37 @@
+package linalg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSolve(t *testing.T) {
+	tests := []struct {
+		name string
+		m    [][]float64
+		v    []float64
+		want []float64
+		ok   bool
+	}{
+		{name: "needs pivoting", m: [][]float64{{0, 1, 1}, {2, 0, 1}, {1, 1, 0}}, v: []float64{5, 5, 3}, want: []float64{1, 2, 3}, ok: true},
+		{name: "singular", m: [][]float64{{1, 2}, {2, 4}}, v: []float64{1, 2}, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m0 := tt.m[0][0]
+			got, ok := Solve(tt.m, tt.v)
+			if ok != tt.ok {
+				t.Fatalf("Solve() ok = %v, want %v", ok, tt.ok)
+			}
+			if tt.m[0][0] != m0 {
+				t.Errorf("Solve() modified m")
+			}
+			for i := range tt.want {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Errorf("Solve() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
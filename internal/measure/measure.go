@@ -0,0 +1,195 @@
+package measure
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// Region is a rectangle on the plate in mm that is measured on its own.
+type Region struct {
+	Name string  `json:"name"`
+	MinX float64 `json:"min_x"`
+	MinY float64 `json:"min_y"`
+	MaxX float64 `json:"max_x"`
+	MaxY float64 `json:"max_y"`
+}
+
+func (r Region) Contains(x float64, y float64) bool {
+	return x >= r.MinX && x <= r.MaxX && y >= r.MinY && y <= r.MaxY
+}
+
+// ParseRegion parses a region given as "name:minX,minY,maxX,maxY".
+func ParseRegion(s string) (Region, error) {
+	r := Region{}
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return r, fmt.Errorf("invalid region \"%s\", expected name:minX,minY,maxX,maxY", s)
+	}
+	r.Name = s[:i]
+	if _, err := fmt.Sscanf(s[i+1:], "%g,%g,%g,%g", &r.MinX, &r.MinY, &r.MaxX, &r.MaxY); err != nil {
+		return r, fmt.Errorf("invalid region \"%s\", expected name:minX,minY,maxX,maxY: %w", s, err)
+	}
+	if r.MinX > r.MaxX {
+		r.MinX, r.MaxX = r.MaxX, r.MinX
+	}
+	if r.MinY > r.MaxY {
+		r.MinY, r.MaxY = r.MaxY, r.MinY
+	}
+
+	return r, nil
+}
+
+type Options struct {
+	Threshold           float64  // heights up to this value in mm count as plate, everything above as material
+	Regions             []Region // regions that are reported on their own in addition to the total
+	IncludeInterpolated bool     // measure the cells filled by FillHoles too
+}
+
+func NewOptions() Options {
+	return Options{
+		Threshold: 0.1,
+	}
+}
+
+func (o Options) Validate() error {
+	if math.IsNaN(o.Threshold) || math.IsInf(o.Threshold, 0) {
+		return fmt.Errorf("Threshold needs to be a finite number but is %f", o.Threshold)
+	}
+	names := map[string]bool{}
+	for _, r := range o.Regions {
+		if r.Name == "" {
+			return fmt.Errorf("every region needs a name")
+		}
+		if names[r.Name] {
+			return fmt.Errorf("region name \"%s\" is used more than once", r.Name)
+		}
+		names[r.Name] = true
+	}
+
+	return nil
+}
+
+// BoundingBox is the axis aligned box around the material in mm.
+type BoundingBox struct {
+	MinX float64 `json:"min_x"`
+	MinY float64 `json:"min_y"`
+	MinZ float64 `json:"min_z"`
+	MaxX float64 `json:"max_x"`
+	MaxY float64 `json:"max_y"`
+	MaxZ float64 `json:"max_z"`
+}
+
+// Result holds the measurements of the material above the threshold within
+// one region. Cells without a valid height and, unless included by the
+// options, cells filled by FillHoles are not part of any measurement.
+type Result struct {
+	Name        string      `json:"name"`
+	Volume      float64     `json:"volume"` // volume above the threshold
+	Area        float64     `json:"area"`   // projected footprint of the material
+	MaxHeight   float64     `json:"max_height"`
+	MeanHeight  float64     `json:"mean_height"` // mean height of the cells above the threshold
+	Cells       int         `json:"cells"`       // number of cells above the threshold
+	BoundingBox BoundingBox `json:"bounding_box"`
+}
+
+// Units names the units of the values in a report.
+type Units struct {
+	Length string `json:"length"`
+	Area   string `json:"area"`
+	Volume string `json:"volume"`
+}
+
+// Report holds the measurements of the whole height map and of every region.
+type Report struct {
+	Units     Units    `json:"units"`
+	Threshold float64  `json:"threshold"`
+	Total     Result   `json:"total"`
+	Regions   []Result `json:"regions,omitempty"`
+}
+
+// Measure integrates the material above the threshold over the whole height
+// map and over every region. The height map is calibrated in mm, so all
+// lengths are in mm, areas in mm² and volumes in mm³.
+func Measure(hm *heightmap.HeightMap, options Options) (Report, error) {
+	if err := options.Validate(); err != nil {
+		return Report{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	report := Report{
+		Units:     Units{Length: "mm", Area: "mm²", Volume: "mm³"},
+		Threshold: options.Threshold,
+		Total:     newResult("total"),
+		Regions:   make([]Result, len(options.Regions)),
+	}
+	for i, r := range options.Regions {
+		report.Regions[i] = newResult(r.Name)
+	}
+
+	for frame := range hm.Frames() {
+		area := hm.CellArea(frame)
+		x := hm.FrameToMM(frame)
+		for row := range hm.Rows() {
+			if !hm.Measured(frame, row) && !(options.IncludeInterpolated && hm.Valid(frame, row)) {
+				continue
+			}
+			h := hm.At(frame, row)
+			if h <= options.Threshold {
+				continue
+			}
+			y := hm.RowToMM(row)
+
+			report.Total.add(x, y, h, area, options.Threshold)
+			for i, r := range options.Regions {
+				if r.Contains(x, y) {
+					report.Regions[i].add(x, y, h, area, options.Threshold)
+				}
+			}
+		}
+	}
+
+	report.Total.finish()
+	for i := range report.Regions {
+		report.Regions[i].finish()
+	}
+
+	return report, nil
+}
+
+func newResult(name string) Result {
+	return Result{
+		Name: name,
+		BoundingBox: BoundingBox{
+			MinX: math.Inf(1), MinY: math.Inf(1), MinZ: math.Inf(1),
+			MaxX: math.Inf(-1), MaxY: math.Inf(-1), MaxZ: math.Inf(-1),
+		},
+	}
+}
+
+func (r *Result) add(x float64, y float64, h float64, area float64, threshold float64) {
+	r.Volume += (h - threshold) * area
+	r.Area += area
+	r.MeanHeight += h
+	r.Cells++
+
+	r.BoundingBox.MinX = math.Min(r.BoundingBox.MinX, x)
+	r.BoundingBox.MinY = math.Min(r.BoundingBox.MinY, y)
+	r.BoundingBox.MinZ = math.Min(r.BoundingBox.MinZ, h)
+	r.BoundingBox.MaxX = math.Max(r.BoundingBox.MaxX, x)
+	r.BoundingBox.MaxY = math.Max(r.BoundingBox.MaxY, y)
+	r.BoundingBox.MaxZ = math.Max(r.BoundingBox.MaxZ, h)
+}
+
+// turns the sums into means and clears the bounding box of empty results, so
+// they can be written as JSON
+func (r *Result) finish() {
+	if r.Cells == 0 {
+		r.BoundingBox = BoundingBox{}
+		return
+	}
+
+	r.MeanHeight /= float64(r.Cells)
+	r.MaxHeight = r.BoundingBox.MaxZ
+}
@@ -0,0 +1,130 @@
+package measure
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+func TestMeasure(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 4
+	options.RowSpacing = 0.5
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two blocks of 2x2 cells of 0.5mm² each, 2mm and 3mm above the threshold
+	for _, heights := range [][]float64{
+		{0, 0, 0, 0},
+		{2.1, 2.1, 0, 0},
+		{2.1, 2.1, 0, math.NaN()},
+		{0, 0, 3.1, 3.1},
+		{0, 0, 3.1, 3.1},
+	} {
+		if err := hm.AddHeightsAt(heights, float64(hm.Frames())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mo := NewOptions()
+	mo.Regions = []Region{
+		{Name: "low", MinX: 0, MinY: 0, MaxX: 2, MaxY: 0.5},
+		{Name: "empty", MinX: 0, MinY: 1, MaxX: 2, MaxY: 2},
+	}
+	report, err := Measure(hm, mo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		result Result
+		want   Result
+	}{
+		{
+			name:   "total",
+			result: report.Total,
+			want:   Result{Name: "total", Volume: 4 + 6, Area: 4, MaxHeight: 3.1, MeanHeight: (2.1*4 + 3.1*4) / 8, Cells: 8},
+		},
+		{
+			name:   "low",
+			result: report.Regions[0],
+			want:   Result{Name: "low", Volume: 2 * 0.5 * 4, Area: 2, MaxHeight: 2.1, MeanHeight: 2.1, Cells: 4},
+		},
+		{
+			name:   "empty",
+			result: report.Regions[1],
+			want:   Result{Name: "empty"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.result
+			if got.Name != tt.want.Name || got.Cells != tt.want.Cells ||
+				math.Abs(got.Volume-tt.want.Volume) > 1e-9 || math.Abs(got.Area-tt.want.Area) > 1e-9 ||
+				math.Abs(got.MaxHeight-tt.want.MaxHeight) > 1e-9 || math.Abs(got.MeanHeight-tt.want.MeanHeight) > 1e-9 {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if want := (BoundingBox{MinX: 1, MinY: 0, MinZ: 2.1, MaxX: 4, MaxY: 1.5, MaxZ: 3.1}); report.Total.BoundingBox != want {
+		t.Errorf("total bounding box = %+v, want %+v", report.Total.BoundingBox, want)
+	}
+}
+
+func TestMeasureInterpolated(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 3
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a 3x3 block of 2mm with a hole in the center
+	for _, heights := range [][]float64{
+		{2, 2, 2},
+		{2, math.NaN(), 2},
+		{2, 2, 2},
+	} {
+		if err := hm.AddHeightsAt(heights, float64(hm.Frames())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if filled := hm.FillHoles(1); filled != 1 {
+		t.Fatalf("FillHoles() = %d, want 1", filled)
+	}
+
+	mo := NewOptions()
+	mo.Threshold = 0
+	for _, tt := range []struct {
+		include bool
+		want    int
+	}{
+		{include: false, want: 8},
+		{include: true, want: 9},
+	} {
+		mo.IncludeInterpolated = tt.include
+		report, err := Measure(hm, mo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Total.Cells != tt.want || math.Abs(report.Total.Volume-2*float64(tt.want)) > 1e-9 {
+			t.Errorf("Measure() with interpolated cells included %v = %d cells and %f mm³, want %d cells", tt.include, report.Total.Cells, report.Total.Volume, tt.want)
+		}
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	r, err := ParseRegion("bead:10,5,0,-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Region{Name: "bead", MinX: 0, MinY: -5, MaxX: 10, MaxY: 5}); r != want {
+		t.Errorf("ParseRegion() = %+v, want %+v", r, want)
+	}
+	if _, err := ParseRegion("bead"); err == nil {
+		t.Errorf("ParseRegion() accepted a region without coordinates")
+	}
+}
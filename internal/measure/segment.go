@@ -0,0 +1,224 @@
+package measure
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+type SegmentOptions struct {
+	Threshold float64 // cells above this height in mm belong to an object
+	MinArea   float64 // objects with a smaller footprint in mm² are removed as noise
+	Diagonal  bool    // cells that only touch at a corner are connected too
+
+	IncludeInterpolated bool // cells filled by FillHoles belong to objects too
+}
+
+func NewSegmentOptions() SegmentOptions {
+	return SegmentOptions{
+		Threshold: 0.1,
+		MinArea:   1,
+		Diagonal:  true,
+	}
+}
+
+func (o SegmentOptions) Validate() error {
+	if math.IsNaN(o.Threshold) || math.IsInf(o.Threshold, 0) {
+		return fmt.Errorf("Threshold needs to be a finite number but is %f", o.Threshold)
+	}
+	if o.MinArea < 0 {
+		return fmt.Errorf("MinArea needs to be at least 0 but is %f", o.MinArea)
+	}
+
+	return nil
+}
+
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// OrientedBoundingBox is the box around the cell centers of an object that is
+// aligned with its principal axis.
+type OrientedBoundingBox struct {
+	Center       Point    `json:"center"`
+	Length       float64  `json:"length"`        // extent along the principal axis
+	Width        float64  `json:"width"`         // extent across the principal axis
+	AngleDegrees float64  `json:"angle_degrees"` // angle of the principal axis to the X axis
+	Corners      [4]Point `json:"corners"`
+}
+
+// Object is a connected group of cells above the threshold.
+type Object struct {
+	ID int `json:"id"`
+	Result
+	Centroid            Point               `json:"centroid"`
+	OrientedBoundingBox OrientedBoundingBox `json:"oriented_bounding_box"`
+	MinHeight           float64             `json:"min_height"`
+	StdDevHeight        float64             `json:"std_dev_height"`
+}
+
+// Segmentation holds the objects and a grid with the ID of the object every
+// cell belongs to, indexed [frame][row]. Cells that belong to no object are 0.
+type Segmentation struct {
+	Units   Units    `json:"units"`
+	Objects []Object `json:"objects"`
+	Labels  [][]int  `json:"-"`
+}
+
+// Segment separates the objects on the plate by labelling the connected cells
+// above the threshold. IDs start at 1 and follow the order in which the
+// objects are found, frame by frame.
+func Segment(hm *heightmap.HeightMap, options SegmentOptions) (Segmentation, error) {
+	if err := options.Validate(); err != nil {
+		return Segmentation{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	seg := Segmentation{
+		Units:  Units{Length: "mm", Area: "mm²", Volume: "mm³"},
+		Labels: make([][]int, hm.Frames()),
+	}
+	for frame := range seg.Labels {
+		seg.Labels[frame] = make([]int, hm.Rows())
+	}
+
+	visited := make([][]bool, hm.Frames())
+	for frame := range visited {
+		visited[frame] = make([]bool, hm.Rows())
+	}
+	above := func(frame int, row int) bool {
+		if !hm.Measured(frame, row) && !(options.IncludeInterpolated && hm.Valid(frame, row)) {
+			return false
+		}
+		return hm.At(frame, row) > options.Threshold
+	}
+
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			if visited[frame][row] || !above(frame, row) {
+				continue
+			}
+
+			cells := collectComponent(frame, row, visited, above, options.Diagonal)
+			obj := newObject(hm, len(seg.Objects)+1, cells, options.Threshold)
+			if obj.Area < options.MinArea {
+				continue
+			}
+			for _, cell := range cells {
+				seg.Labels[cell[0]][cell[1]] = obj.ID
+			}
+			seg.Objects = append(seg.Objects, obj)
+		}
+	}
+
+	return seg, nil
+}
+
+// collects the connected cells for which include is true starting at the given cell
+func collectComponent(frame int, row int, visited [][]bool, include func(frame int, row int) bool, diagonal bool) [][2]int {
+	offsets := [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	if diagonal {
+		offsets = append(offsets, [2]int{-1, -1}, [2]int{-1, 1}, [2]int{1, -1}, [2]int{1, 1})
+	}
+
+	cells := [][2]int{}
+	stack := [][2]int{{frame, row}}
+	visited[frame][row] = true
+	for len(stack) > 0 {
+		cell := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		cells = append(cells, cell)
+
+		for _, o := range offsets {
+			f, r := cell[0]+o[0], cell[1]+o[1]
+			if f < 0 || f >= len(visited) || r < 0 || r >= len(visited[f]) || visited[f][r] || !include(f, r) {
+				continue
+			}
+			visited[f][r] = true
+			stack = append(stack, [2]int{f, r})
+		}
+	}
+
+	return cells
+}
+
+func newObject(hm *heightmap.HeightMap, id int, cells [][2]int, threshold float64) Object {
+	obj := Object{
+		ID:        id,
+		Result:    newResult(fmt.Sprintf("object %d", id)),
+		MinHeight: math.Inf(1),
+	}
+
+	// the centroid and principal axis are weighted by the area of the cells,
+	// since frames do not need to be evenly spaced
+	points := make([]Point, len(cells))
+	weights := make([]float64, len(cells))
+	for i, cell := range cells {
+		x, y, h := hm.FrameToMM(cell[0]), hm.RowToMM(cell[1]), hm.At(cell[0], cell[1])
+		area := hm.CellArea(cell[0])
+		obj.add(x, y, h, area, threshold)
+		obj.MinHeight = math.Min(obj.MinHeight, h)
+		obj.Centroid.X += x * area
+		obj.Centroid.Y += y * area
+		points[i] = Point{X: x, Y: y}
+		weights[i] = area
+	}
+	obj.finish()
+
+	if obj.Area > 0 {
+		obj.Centroid.X /= obj.Area
+		obj.Centroid.Y /= obj.Area
+	}
+
+	variance := 0.0
+	for _, cell := range cells {
+		d := hm.At(cell[0], cell[1]) - obj.MeanHeight
+		variance += d * d
+	}
+	obj.StdDevHeight = math.Sqrt(variance / float64(len(cells)))
+	obj.OrientedBoundingBox = orientedBoundingBox(points, weights, obj.Centroid)
+
+	return obj
+}
+
+// uses the principal axis of the points as orientation of the box
+func orientedBoundingBox(points []Point, weights []float64, centroid Point) OrientedBoundingBox {
+	var sxx, syy, sxy, sw float64
+	for i, p := range points {
+		dx, dy := p.X-centroid.X, p.Y-centroid.Y
+		sxx += weights[i] * dx * dx
+		syy += weights[i] * dy * dy
+		sxy += weights[i] * dx * dy
+		sw += weights[i]
+	}
+	angle := 0.0
+	if sw > 0 {
+		angle = 0.5 * math.Atan2(2*sxy, sxx-syy)
+	}
+	ux, uy := math.Cos(angle), math.Sin(angle)
+	vx, vy := -uy, ux
+
+	minU, maxU := math.Inf(1), math.Inf(-1)
+	minV, maxV := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		dx, dy := p.X-centroid.X, p.Y-centroid.Y
+		u := dx*ux + dy*uy
+		v := dx*vx + dy*vy
+		minU, maxU = math.Min(minU, u), math.Max(maxU, u)
+		minV, maxV = math.Min(minV, v), math.Max(maxV, v)
+	}
+
+	at := func(u float64, v float64) Point {
+		return Point{X: centroid.X + u*ux + v*vx, Y: centroid.Y + u*uy + v*vy}
+	}
+	box := OrientedBoundingBox{
+		Center:       at((minU+maxU)/2, (minV+maxV)/2),
+		Length:       maxU - minU,
+		Width:        maxV - minV,
+		AngleDegrees: angle * 180 / math.Pi,
+		Corners:      [4]Point{at(minU, minV), at(maxU, minV), at(maxU, maxV), at(minU, maxV)},
+	}
+
+	return box
+}
@@ -0,0 +1,122 @@
+package measure
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+func TestSegment(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 6
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a diagonal bar of 4 cells, a 2x2 block and a single noise cell
+	for _, heights := range [][]float64{
+		{1, 0, 0, 0, 2, 2},
+		{0, 1, 0, 0, 2, 4},
+		{0, 0, 1, 0, 0, 0},
+		{0, 0, 0, 1, 0, 0},
+		{0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 5},
+	} {
+		if err := hm.AddHeightsAt(heights, float64(hm.Frames())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := NewSegmentOptions()
+	so.MinArea = 2
+	seg, err := Segment(hm, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seg.Objects) != 2 {
+		t.Fatalf("Segment() found %d objects, want 2", len(seg.Objects))
+	}
+	if seg.Labels[0][0] != 1 || seg.Labels[1][5] != 2 || seg.Labels[5][5] != 0 {
+		t.Errorf("Segment() labels are wrong: %v", seg.Labels)
+	}
+
+	tests := []struct {
+		name                   string
+		object                 Object
+		centroid               Point
+		angle, length, width   float64
+		volume, mean, min, max float64
+	}{
+		{name: "diagonal bar", object: seg.Objects[0], centroid: Point{X: 1.5, Y: 1.5}, angle: 45, length: 3 * math.Sqrt2, width: 0, volume: 4 * 0.9, mean: 1, min: 1, max: 1},
+		{name: "block", object: seg.Objects[1], centroid: Point{X: 0.5, Y: 4.5}, angle: 0, length: 1, width: 1, volume: 1.9*3 + 3.9, mean: 2.5, min: 2, max: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := tt.object
+			obb := o.OrientedBoundingBox
+			for _, c := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"centroid x", o.Centroid.X, tt.centroid.X},
+				{"centroid y", o.Centroid.Y, tt.centroid.Y},
+				{"angle", math.Mod(obb.AngleDegrees+180, 180), tt.angle},
+				{"length", obb.Length, tt.length},
+				{"width", obb.Width, tt.width},
+				{"volume", o.Volume, tt.volume},
+				{"mean height", o.MeanHeight, tt.mean},
+				{"min height", o.MinHeight, tt.min},
+				{"max height", o.MaxHeight, tt.max},
+			} {
+				if math.Abs(c.got-c.want) > 1e-9 {
+					t.Errorf("%s = %f, want %f", c.name, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSegmentInterpolated(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 3
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a 3x3 block with a hole in the center
+	for _, heights := range [][]float64{
+		{2, 2, 2},
+		{2, math.NaN(), 2},
+		{2, 2, 2},
+	} {
+		if err := hm.AddHeightsAt(heights, float64(hm.Frames())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if filled := hm.FillHoles(1); filled != 1 {
+		t.Fatalf("FillHoles() = %d, want 1", filled)
+	}
+
+	so := NewSegmentOptions()
+	for _, tt := range []struct {
+		include bool
+		want    int
+		label   int
+	}{
+		{include: false, want: 8, label: 0},
+		{include: true, want: 9, label: 1},
+	} {
+		so.IncludeInterpolated = tt.include
+		seg, err := Segment(hm, so)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seg.Objects) != 1 {
+			t.Fatalf("Segment() found %d objects, want 1", len(seg.Objects))
+		}
+		if seg.Objects[0].Cells != tt.want || seg.Labels[1][1] != tt.label {
+			t.Errorf("Segment() with interpolated cells included %v = %d cells and label %d in the hole, want %d cells and label %d", tt.include, seg.Objects[0].Cells, seg.Labels[1][1], tt.want, tt.label)
+		}
+	}
+}
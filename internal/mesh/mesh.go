@@ -0,0 +1,200 @@
+package mesh
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+type Vec3 struct {
+	X, Y, Z float64
+}
+
+func (a Vec3) Add(b Vec3) Vec3 {
+	return Vec3{X: a.X + b.X, Y: a.Y + b.Y, Z: a.Z + b.Z}
+}
+
+func (a Vec3) Sub(b Vec3) Vec3 {
+	return Vec3{X: a.X - b.X, Y: a.Y - b.Y, Z: a.Z - b.Z}
+}
+
+func (a Vec3) Scale(f float64) Vec3 {
+	return Vec3{X: a.X * f, Y: a.Y * f, Z: a.Z * f}
+}
+
+func (a Vec3) Dot(b Vec3) float64 {
+	return a.X*b.X + a.Y*b.Y + a.Z*b.Z
+}
+
+func (a Vec3) Cross(b Vec3) Vec3 {
+	return Vec3{
+		X: a.Y*b.Z - a.Z*b.Y,
+		Y: a.Z*b.X - a.X*b.Z,
+		Z: a.X*b.Y - a.Y*b.X,
+	}
+}
+
+func (a Vec3) Length() float64 {
+	return math.Sqrt(a.Dot(a))
+}
+
+// Normalize returns the vector scaled to length 1, the zero vector stays zero.
+func (a Vec3) Normalize() Vec3 {
+	l := a.Length()
+	if l == 0 {
+		return a
+	}
+
+	return a.Scale(1 / l)
+}
+
+// Triangle holds the indices of its vertices in counter-clockwise order when
+// looking at the outside of the mesh.
+type Triangle [3]int
+
+type Mesh struct {
+	Vertices  []Vec3
+	Triangles []Triangle
+}
+
+// Normal returns the unit normal of a triangle.
+func (m *Mesh) Normal(triangle int) Vec3 {
+	t := m.Triangles[triangle]
+	a := m.Vertices[t[0]]
+
+	return m.Vertices[t[1]].Sub(a).Cross(m.Vertices[t[2]].Sub(a)).Normalize()
+}
+
+// VertexNormals returns the area weighted average of the normals of all
+// triangles sharing a vertex.
+func (m *Mesh) VertexNormals() []Vec3 {
+	normals := make([]Vec3, len(m.Vertices))
+	for _, t := range m.Triangles {
+		a := m.Vertices[t[0]]
+		n := m.Vertices[t[1]].Sub(a).Cross(m.Vertices[t[2]].Sub(a))
+		for _, v := range t {
+			normals[v] = normals[v].Add(n)
+		}
+	}
+	for i := range normals {
+		normals[i] = normals[i].Normalize()
+	}
+
+	return normals
+}
+
+type Options struct {
+	Solid      bool    // add a flat base and side walls so the mesh is watertight
+	BaseHeight float64 // height of the base in mm, needs to be below the lowest point
+}
+
+func NewOptions() Options {
+	return Options{
+		Solid:      true,
+		BaseHeight: -1,
+	}
+}
+
+// FromHeightMap triangulates the grid of the height map. Cells with an invalid
+// corner are skipped instead of being pulled down to zero, cells with three
+// valid corners get a single triangle. The vertices include the lateral offset
+// of the cells.
+func FromHeightMap(hm *heightmap.HeightMap, options Options) (*Mesh, error) {
+	m := &Mesh{Vertices: []Vec3{}, Triangles: []Triangle{}}
+
+	indices := make([][]int, hm.Frames())
+	for frame := range indices {
+		indices[frame] = make([]int, hm.Rows())
+		for row := range indices[frame] {
+			indices[frame][row] = -1
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			if options.Solid && hm.At(frame, row) < options.BaseHeight {
+				return nil, fmt.Errorf("base height %f is above the height %f of frame %d row %d", options.BaseHeight, hm.At(frame, row), frame, row)
+			}
+			indices[frame][row] = len(m.Vertices)
+			x, y, z := hm.PointAt(frame, row)
+			m.Vertices = append(m.Vertices, Vec3{X: x, Y: y, Z: z})
+		}
+	}
+
+	for frame := 0; frame < hm.Frames()-1; frame++ {
+		for row := 0; row < hm.Rows()-1; row++ {
+			a := indices[frame][row]
+			b := indices[frame+1][row]
+			c := indices[frame+1][row+1]
+			d := indices[frame][row+1]
+
+			switch {
+			case a >= 0 && b >= 0 && c >= 0 && d >= 0:
+				m.addUpwardTriangle(a, b, c)
+				m.addUpwardTriangle(a, c, d)
+			case b >= 0 && c >= 0 && d >= 0:
+				m.addUpwardTriangle(b, c, d)
+			case a >= 0 && c >= 0 && d >= 0:
+				m.addUpwardTriangle(a, c, d)
+			case a >= 0 && b >= 0 && d >= 0:
+				m.addUpwardTriangle(a, b, d)
+			case a >= 0 && b >= 0 && c >= 0:
+				m.addUpwardTriangle(a, b, c)
+			}
+		}
+	}
+
+	if options.Solid {
+		m.closeWithBase(options.BaseHeight)
+	}
+
+	return m, nil
+}
+
+// adds the triangle so that its normal points up, frames can be positioned in
+// either direction so the winding is not known beforehand
+func (m *Mesh) addUpwardTriangle(a, b, c int) {
+	va := m.Vertices[a]
+	n := m.Vertices[b].Sub(va).Cross(m.Vertices[c].Sub(va))
+	if n.Z < 0 {
+		b, c = c, b
+	}
+	m.Triangles = append(m.Triangles, Triangle{a, b, c})
+}
+
+// mirrors the surface onto a flat base and connects every boundary edge of the
+// surface with the base by a wall
+func (m *Mesh) closeWithBase(baseHeight float64) {
+	top := m.Triangles
+	surfaceVertices := len(m.Vertices)
+	for i := range surfaceVertices {
+		v := m.Vertices[i]
+		m.Vertices = append(m.Vertices, Vec3{X: v.X, Y: v.Y, Z: baseHeight})
+	}
+	base := func(v int) int {
+		return v + surfaceVertices
+	}
+
+	type edge struct{ from, to int }
+	edges := map[edge]bool{}
+	for _, t := range top {
+		for i := range 3 {
+			edges[edge{from: t[i], to: t[(i+1)%3]}] = true
+		}
+	}
+
+	for _, t := range top {
+		m.Triangles = append(m.Triangles, Triangle{base(t[0]), base(t[2]), base(t[1])})
+
+		for i := range 3 {
+			u, v := t[i], t[(i+1)%3]
+			if edges[edge{from: v, to: u}] {
+				// shared with a neighbouring triangle, not a boundary
+				continue
+			}
+			m.Triangles = append(m.Triangles,
+				Triangle{u, base(u), base(v)},
+				Triangle{u, base(v), v},
+			)
+		}
+	}
+}
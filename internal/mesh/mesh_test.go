@@ -0,0 +1,117 @@
+package mesh
+
+import (
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+func newHeightMap(t *testing.T, profiles []map[int]float64, rows int) *heightmap.HeightMap {
+	options := heightmap.NewOptions()
+	options.Rows = rows
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, profile := range profiles {
+		if err := hm.AddProfile(profile); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return hm
+}
+
+// a mesh is watertight if every edge is used exactly once in each direction
+func isWatertight(m *Mesh) bool {
+	type edge struct{ from, to int }
+	edges := map[edge]int{}
+	for _, t := range m.Triangles {
+		for i := range 3 {
+			edges[edge{from: t[i], to: t[(i+1)%3]}]++
+		}
+	}
+	for e, count := range edges {
+		if count != 1 || edges[edge{from: e.to, to: e.from}] != 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestFromHeightMap(t *testing.T) {
+	tests := []struct {
+		name          string
+		profiles      []map[int]float64
+		rows          int
+		options       Options
+		wantTriangles int
+		wantErr       bool
+	}{
+		{
+			name:          "full grid surface only",
+			profiles:      []map[int]float64{{0: 1, 1: 1, 2: 1}, {0: 1, 1: 2, 2: 1}, {0: 1, 1: 1, 2: 1}},
+			rows:          3,
+			options:       Options{Solid: false},
+			wantTriangles: 8,
+		},
+		{
+			name:          "invalid cell is skipped",
+			profiles:      []map[int]float64{{0: 1, 1: 1}, {0: 1, 1: -1}},
+			rows:          2,
+			options:       Options{Solid: false},
+			wantTriangles: 1,
+		},
+		{
+			name:          "solid full grid",
+			profiles:      []map[int]float64{{0: 1, 1: 1, 2: 1}, {0: 1, 1: 2, 2: 1}, {0: 1, 1: 1, 2: 1}},
+			rows:          3,
+			options:       Options{Solid: true, BaseHeight: 0},
+			wantTriangles: 8 + 8 + 8*2,
+		},
+		{
+			name: "solid grid with hole",
+			profiles: []map[int]float64{
+				{0: 1, 1: 1, 2: 1, 3: 1, 4: 1},
+				{0: 1, 1: 1, 2: 1, 3: 1, 4: 1},
+				{0: 1, 1: 1, 2: -1, 3: 1, 4: 1},
+				{0: 1, 1: 1, 2: 1, 3: 1, 4: 1},
+				{0: 1, 1: 1, 2: 1, 3: 1, 4: 1},
+			},
+			rows:          5,
+			options:       Options{Solid: true, BaseHeight: 0},
+			wantTriangles: 28 + 28 + (16+4)*2,
+		},
+		{
+			name:     "base above surface",
+			profiles: []map[int]float64{{0: 1, 1: 1}, {0: 1, 1: 1}},
+			rows:     2,
+			options:  Options{Solid: true, BaseHeight: 2},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := FromHeightMap(newHeightMap(t, tt.profiles, tt.rows), tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FromHeightMap() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if len(m.Triangles) != tt.wantTriangles {
+				t.Errorf("FromHeightMap() has %d triangles, want %d", len(m.Triangles), tt.wantTriangles)
+			}
+			if tt.options.Solid && !isWatertight(m) {
+				t.Errorf("FromHeightMap() with Solid is not watertight")
+			}
+			for i := range m.Triangles {
+				if !tt.options.Solid && m.Normal(i).Z <= 0 {
+					t.Errorf("triangle %d of the surface points down", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package mesh
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+type RenderOptions struct {
+	SpacingX float64 // distance between two frames in mm, usually the feed per frame of the scan
+	SpacingY float64 // distance between two rows in mm, usually the row spacing of the scan
+	Margin   float64 // plate around the model in mm
+	OnPlate  bool    // moves the lowest point of the model to 0 and fills the cells around it with the plate
+}
+
+func NewRenderOptions() RenderOptions {
+	return RenderOptions{
+		SpacingX: 0.1,
+		SpacingY: 0.1,
+		Margin:   2,
+		OnPlate:  true,
+	}
+}
+
+func (o RenderOptions) Validate() error {
+	if o.SpacingX <= 0 || o.SpacingY <= 0 {
+		return fmt.Errorf("SpacingX and SpacingY need to be greater than 0 but are %f and %f", o.SpacingX, o.SpacingY)
+	}
+	if o.Margin < 0 {
+		return fmt.Errorf("Margin needs to be at least 0 but is %f", o.Margin)
+	}
+
+	return nil
+}
+
+// RenderHeightMap renders the height map a scanner looking down at the mesh
+// would see, which is the highest surface above every cell. Frames run along
+// X and rows along Y. Cells the mesh does not cover are NaN, or the plate at
+// 0 with OnPlate.
+func (m *Mesh) RenderHeightMap(options RenderOptions) (*heightmap.HeightMap, error) {
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+	if len(m.Triangles) == 0 {
+		return nil, fmt.Errorf("the mesh has no triangles")
+	}
+
+	lo := Vec3{X: math.Inf(1), Y: math.Inf(1), Z: math.Inf(1)}
+	hi := Vec3{X: math.Inf(-1), Y: math.Inf(-1), Z: math.Inf(-1)}
+	for _, t := range m.Triangles {
+		for _, i := range t {
+			v := m.Vertices[i]
+			lo = Vec3{X: math.Min(lo.X, v.X), Y: math.Min(lo.Y, v.Y), Z: math.Min(lo.Z, v.Z)}
+			hi = Vec3{X: math.Max(hi.X, v.X), Y: math.Max(hi.Y, v.Y), Z: math.Max(hi.Z, v.Z)}
+		}
+	}
+	originX, originY := lo.X-options.Margin, lo.Y-options.Margin
+	frames := int(math.Floor((hi.X+options.Margin-originX)/options.SpacingX)) + 1
+	rows := int(math.Floor((hi.Y+options.Margin-originY)/options.SpacingY)) + 1
+	zOffset := 0.0
+	if options.OnPlate {
+		zOffset = -lo.Z
+	}
+
+	heights := make([][]float64, frames)
+	for frame := range heights {
+		heights[frame] = make([]float64, rows)
+		for row := range heights[frame] {
+			heights[frame][row] = math.NaN()
+		}
+	}
+
+	for _, t := range m.Triangles {
+		a, b, c := m.Vertices[t[0]], m.Vertices[t[1]], m.Vertices[t[2]]
+		// twice the signed area in XY, vertical triangles are not visible from above
+		area := (b.X-a.X)*(c.Y-a.Y) - (c.X-a.X)*(b.Y-a.Y)
+		if math.Abs(area) < 1e-12 {
+			continue
+		}
+
+		firstFrame := max(0, int(math.Ceil((min(a.X, b.X, c.X)-originX)/options.SpacingX)))
+		lastFrame := min(frames-1, int(math.Floor((max(a.X, b.X, c.X)-originX)/options.SpacingX)))
+		firstRow := max(0, int(math.Ceil((min(a.Y, b.Y, c.Y)-originY)/options.SpacingY)))
+		lastRow := min(rows-1, int(math.Floor((max(a.Y, b.Y, c.Y)-originY)/options.SpacingY)))
+		for frame := firstFrame; frame <= lastFrame; frame++ {
+			x := originX + float64(frame)*options.SpacingX
+			for row := firstRow; row <= lastRow; row++ {
+				y := originY + float64(row)*options.SpacingY
+				// barycentric coordinates of the cell center
+				wb := ((x-a.X)*(c.Y-a.Y) - (c.X-a.X)*(y-a.Y)) / area
+				wc := ((b.X-a.X)*(y-a.Y) - (x-a.X)*(b.Y-a.Y)) / area
+				wa := 1 - wb - wc
+				const eps = -1e-9
+				if wa < eps || wb < eps || wc < eps {
+					continue
+				}
+				z := wa*a.Z + wb*b.Z + wc*c.Z + zOffset
+				if math.IsNaN(heights[frame][row]) || z > heights[frame][row] {
+					heights[frame][row] = z
+				}
+			}
+		}
+	}
+
+	hmOptions := heightmap.NewOptions()
+	hmOptions.Rows = rows
+	hmOptions.FeedPerFrame = options.SpacingX
+	hmOptions.RowSpacing = options.SpacingY
+	hmOptions.RowOffset = originY
+	hm, err := heightmap.New(hmOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create height map: %w", err)
+	}
+	for frame, h := range heights {
+		if options.OnPlate {
+			for row := range h {
+				if math.IsNaN(h[row]) {
+					h[row] = 0
+				}
+			}
+		}
+		if err := hm.AddHeightsAt(h, originX+float64(frame)*options.SpacingX); err != nil {
+			return nil, fmt.Errorf("failed to add frame %d: %w", frame, err)
+		}
+	}
+
+	return hm, nil
+}
@@ -0,0 +1,46 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRenderHeightMap(t *testing.T) {
+	// a pyramid with a 4x4mm base and its apex 2mm above the plate at (2, 2)
+	m := &Mesh{
+		Vertices:  []Vec3{{X: 0, Y: 0, Z: 1}, {X: 4, Y: 0, Z: 1}, {X: 4, Y: 4, Z: 1}, {X: 0, Y: 4, Z: 1}, {X: 2, Y: 2, Z: 3}},
+		Triangles: []Triangle{{0, 1, 4}, {1, 2, 4}, {2, 3, 4}, {3, 0, 4}, {0, 2, 1}, {0, 3, 2}},
+	}
+
+	tests := []struct {
+		name    string
+		onPlate bool
+		apex    float64
+		plate   float64
+	}{
+		{name: "on the plate", onPlate: true, apex: 2, plate: 0},
+		{name: "without plate", onPlate: false, apex: 3, plate: math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := RenderOptions{SpacingX: 0.5, SpacingY: 0.25, Margin: 1, OnPlate: tt.onPlate}
+			hm, err := m.RenderHeightMap(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hm.Frames() != 13 || hm.Rows() != 25 {
+				t.Fatalf("RenderHeightMap() has %d frames and %d rows, want 13 and 25", hm.Frames(), hm.Rows())
+			}
+			if got := hm.HeightAt(2, 2); math.Abs(got-tt.apex) > 1e-9 {
+				t.Errorf("height at the apex is %f, want %f", got, tt.apex)
+			}
+			// halfway down the side
+			if got := hm.HeightAt(3, 2); math.Abs(got-(tt.apex-1)) > 1e-9 {
+				t.Errorf("height on the side is %f, want %f", got, tt.apex-1)
+			}
+			if got := hm.At(0, 0); !(got == tt.plate || math.IsNaN(got) && math.IsNaN(tt.plate)) {
+				t.Errorf("height of the plate is %f, want %f", got, tt.plate)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package mesh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// ReadSTL reads an ASCII or binary STL file. Vertices with the same position
+// are merged, so triangles share their vertices like in meshes built from
+// height maps.
+func ReadSTL(r io.Reader) (*Mesh, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read STL: %w", err)
+	}
+
+	// binary files may also start with "solid", so the size decides
+	if len(data) >= 84 {
+		count := binary.LittleEndian.Uint32(data[80:84])
+		if uint64(len(data)) == 84+50*uint64(count) {
+			return readSTLBinary(data[84:], int(count)), nil
+		}
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return nil, fmt.Errorf("the file is neither a binary nor an ASCII STL")
+	}
+
+	return readSTLASCII(data)
+}
+
+// LoadSTL reads an ASCII or binary STL file.
+func LoadSTL(filename string) (*Mesh, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open STL: %w", err)
+	}
+	defer f.Close()
+
+	return ReadSTL(f)
+}
+
+// collects the triangles and merges vertices with the same position
+type stlBuilder struct {
+	mesh    *Mesh
+	indices map[Vec3]int
+}
+
+func newSTLBuilder() *stlBuilder {
+	return &stlBuilder{mesh: &Mesh{}, indices: map[Vec3]int{}}
+}
+
+func (b *stlBuilder) add(vertices [3]Vec3) {
+	t := Triangle{}
+	for i, v := range vertices {
+		index, ok := b.indices[v]
+		if !ok {
+			index = len(b.mesh.Vertices)
+			b.indices[v] = index
+			b.mesh.Vertices = append(b.mesh.Vertices, v)
+		}
+		t[i] = index
+	}
+	b.mesh.Triangles = append(b.mesh.Triangles, t)
+}
+
+func readSTLBinary(data []byte, count int) *Mesh {
+	b := newSTLBuilder()
+	f := func(offset int) float64 {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data[offset:])))
+	}
+	for i := range count {
+		// the normal in the first 12 bytes is ignored, the winding defines it
+		offset := i*50 + 12
+		vertices := [3]Vec3{}
+		for v := range vertices {
+			o := offset + v*12
+			vertices[v] = Vec3{X: f(o), Y: f(o + 4), Z: f(o + 8)}
+		}
+		b.add(vertices)
+	}
+
+	return b.mesh
+}
+
+func readSTLASCII(data []byte) (*Mesh, error) {
+	b := newSTLBuilder()
+	vertices := [3]Vec3{}
+	n := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "vertex":
+			if n >= 3 {
+				return nil, fmt.Errorf("line %d: facet has more than 3 vertices", line)
+			}
+			v := Vec3{}
+			if _, err := fmt.Sscan(strings.Join(fields[1:], " "), &v.X, &v.Y, &v.Z); err != nil {
+				return nil, fmt.Errorf("line %d: invalid vertex: %w", line, err)
+			}
+			vertices[n] = v
+			n++
+		case "endfacet":
+			if n != 3 {
+				return nil, fmt.Errorf("line %d: facet has %d vertices instead of 3", line, n)
+			}
+			b.add(vertices)
+			n = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read STL: %w", err)
+	}
+
+	return b.mesh, nil
+}
@@ -0,0 +1,88 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// a tetrahedron, every vertex is used by three triangles
+var tetrahedron = [][3]Vec3{
+	{{X: 0, Y: 0, Z: 0}, {X: 0, Y: 1, Z: 0}, {X: 1, Y: 0, Z: 0}},
+	{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}, {X: 0, Y: 0, Z: 1}},
+	{{X: 0, Y: 0, Z: 0}, {X: 0, Y: 0, Z: 1}, {X: 0, Y: 1, Z: 0}},
+	{{X: 1, Y: 0, Z: 0}, {X: 0, Y: 1, Z: 0}, {X: 0, Y: 0, Z: 1}},
+}
+
+func tetrahedronASCII() string {
+	sb := strings.Builder{}
+	sb.WriteString("solid test\n")
+	for _, t := range tetrahedron {
+		sb.WriteString("facet normal 0 0 0\nouter loop\n")
+		for _, v := range t {
+			fmt.Fprintf(&sb, "vertex %g %g %g\n", v.X, v.Y, v.Z)
+		}
+		sb.WriteString("endloop\nendfacet\n")
+	}
+	sb.WriteString("endsolid test\n")
+
+	return sb.String()
+}
+
+func tetrahedronBinary() []byte {
+	buf := bytes.Buffer{}
+	header := make([]byte, 80)
+	// binary files starting with "solid" are not ASCII
+	copy(header, "solid binary")
+	buf.Write(header)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(tetrahedron)))
+	for _, t := range tetrahedron {
+		binary.Write(&buf, binary.LittleEndian, [3]float32{})
+		for _, v := range t {
+			binary.Write(&buf, binary.LittleEndian, [3]float32{float32(v.X), float32(v.Y), float32(v.Z)})
+		}
+		binary.Write(&buf, binary.LittleEndian, uint16(0))
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadSTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "ascii", data: []byte(tetrahedronASCII())},
+		{name: "binary", data: tetrahedronBinary()},
+		{name: "facet with two vertices", data: []byte("solid test\nfacet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nendloop\nendfacet\nendsolid test\n"), wantErr: true},
+		{name: "invalid vertex", data: []byte("solid test\nfacet normal 0 0 1\nouter loop\nvertex 0 a 0\n"), wantErr: true},
+		{name: "no stl", data: []byte("hello"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ReadSTL(bytes.NewReader(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadSTL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(m.Triangles) != 4 || len(m.Vertices) != 4 {
+				t.Fatalf("ReadSTL() has %d triangles and %d vertices, want 4 and 4", len(m.Triangles), len(m.Vertices))
+			}
+			for i, triangle := range m.Triangles {
+				for j, v := range triangle {
+					if m.Vertices[v] != tetrahedron[i][j] {
+						t.Errorf("vertex %d of triangle %d is %+v, want %+v", j, i, m.Vertices[v], tetrahedron[i][j])
+					}
+				}
+			}
+			if !isWatertight(m) {
+				t.Errorf("ReadSTL() did not merge the vertices")
+			}
+		})
+	}
+}
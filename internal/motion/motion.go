@@ -0,0 +1,156 @@
+package motion
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sample is a single reading of the encoder or stepper position.
+type Sample struct {
+	Timestamp float64 `json:"timestamp"` // seconds since the start of the video
+	Position  float64 `json:"position"`  // position along the feed direction in mm
+}
+
+// Log is a time-sorted list of motion samples that positions can be
+// interpolated from.
+type Log struct {
+	samples []Sample
+}
+
+func NewLog(samples []Sample) (*Log, error) {
+	if len(samples) < 2 {
+		return nil, fmt.Errorf("a motion log needs at least 2 samples but got %d", len(samples))
+	}
+
+	sorted := make([]Sample, len(samples))
+	copy(sorted, samples)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Timestamp == sorted[i-1].Timestamp {
+			return nil, fmt.Errorf("duplicate timestamp %f in motion log", sorted[i].Timestamp)
+		}
+	}
+
+	return &Log{samples: sorted}, nil
+}
+
+// Load reads a motion log from a .csv or .json file.
+func Load(filename string) (*Log, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open motion log: %w", err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return LoadCSV(f)
+	case ".json":
+		return LoadJSON(f)
+	}
+
+	return nil, fmt.Errorf("unsupported motion log format \"%s\". Valid formats are: .csv, .json", filepath.Ext(filename))
+}
+
+// LoadCSV reads "timestamp,position" records. A header line is skipped.
+func LoadCSV(r io.Reader) (*Log, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read motion log csv: %w", err)
+	}
+
+	samples := []Sample{}
+	for i, record := range records {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d of motion log has %d columns, need timestamp and position", i+1, len(record))
+		}
+		timestamp, err := strconv.ParseFloat(record[0], 64)
+		if err != nil {
+			if i == 0 {
+				// header
+				continue
+			}
+			return nil, fmt.Errorf("failed to parse timestamp in line %d: %w", i+1, err)
+		}
+		position, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse position in line %d: %w", i+1, err)
+		}
+		samples = append(samples, Sample{Timestamp: timestamp, Position: position})
+	}
+
+	return NewLog(samples)
+}
+
+// LoadJSON reads an array of {"timestamp": ..., "position": ...} objects.
+func LoadJSON(r io.Reader) (*Log, error) {
+	samples := []Sample{}
+	if err := json.NewDecoder(r).Decode(&samples); err != nil {
+		return nil, fmt.Errorf("failed to read motion log json: %w", err)
+	}
+
+	return NewLog(samples)
+}
+
+// PositionAt linearly interpolates the position at the given timestamp.
+// Timestamps outside of the log are an error since extrapolating the motion
+// of a stage that does not move at constant speed is not reliable.
+func (l *Log) PositionAt(timestamp float64) (float64, error) {
+	first := l.samples[0]
+	last := l.samples[len(l.samples)-1]
+	if timestamp < first.Timestamp || timestamp > last.Timestamp {
+		return 0, fmt.Errorf("timestamp %f is outside of the motion log (%f - %f)", timestamp, first.Timestamp, last.Timestamp)
+	}
+
+	i := sort.Search(len(l.samples), func(i int) bool {
+		return l.samples[i].Timestamp >= timestamp
+	})
+	if l.samples[i].Timestamp == timestamp {
+		return l.samples[i].Position, nil
+	}
+
+	before := l.samples[i-1]
+	after := l.samples[i]
+	factor := (timestamp - before.Timestamp) / (after.Timestamp - before.Timestamp)
+
+	return before.Position + factor*(after.Position-before.Position), nil
+}
+
+// FramePosition returns the position of a video frame, using FPS and the
+// frame index to calculate the frame's timestamp.
+func (l *Log) FramePosition(frame int, fps float64) (float64, error) {
+	if fps <= 0 {
+		return 0, fmt.Errorf("fps needs to be greater than 0 but is %f", fps)
+	}
+
+	return l.PositionAt(float64(frame) / fps)
+}
+
+// Positioner returns the frame positions of a video with the given FPS.
+func (l *Log) Positioner(fps float64) *Positioner {
+	return &Positioner{log: l, fps: fps}
+}
+
+// Positioner maps frame indices of a video to positions from the motion log.
+type Positioner struct {
+	log *Log
+	fps float64
+}
+
+func (p *Positioner) FramePosition(frame int) (float64, error) {
+	return p.log.FramePosition(frame, p.fps)
+}
@@ -0,0 +1,55 @@
+package motion
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFramePosition(t *testing.T) {
+	log, err := LoadCSV(strings.NewReader("timestamp,position\n0,0\n1,10\n2,30\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		frame   int
+		fps     float64
+		want    float64
+		wantErr bool
+	}{
+		{name: "first sample", frame: 0, fps: 10, want: 0},
+		{name: "between first and second sample", frame: 5, fps: 10, want: 5},
+		{name: "exactly on a sample", frame: 10, fps: 10, want: 10},
+		{name: "faster second segment", frame: 15, fps: 10, want: 20},
+		{name: "after the log", frame: 21, fps: 10, wantErr: true},
+		{name: "invalid fps", frame: 1, fps: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := log.FramePosition(tt.frame, tt.fps)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FramePosition() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FramePosition() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	log, err := LoadJSON(strings.NewReader(`[{"timestamp": 1, "position": 4}, {"timestamp": 0, "position": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := log.PositionAt(0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 3 {
+		t.Errorf("PositionAt(0.5) = %f, want 3", got)
+	}
+}
@@ -0,0 +1,82 @@
+package pointcloud
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// Point is a single measurement in mm. X is the feed direction, Y the
+// direction along the laser line and Z the height above the plate.
+type Point struct {
+	X, Y, Z    float64
+	Color      color.RGBA
+	Confidence float64
+}
+
+type PointCloud struct {
+	Points   []Point
+	HasColor bool // true if the points carry colors sampled from the camera frames
+}
+
+// Frame is a single profile together with its position and the camera frame
+// it was determined from.
+type Frame struct {
+	Profile  frameprocessor.Profile
+	Index    int         // index of the camera frame, shared by the profiles of all lines in the multi-line mode
+	Position float64     // position along the feed direction in mm
+	Image    image.Image // optional, used to sample the point colors
+}
+
+// FromHeightMap converts every valid cell of the height map into a point at
+// the position of the frame plus the lateral offset of the cell. Cells without
+// a measurement are left out.
+func FromHeightMap(hm *heightmap.HeightMap) *PointCloud {
+	pc := &PointCloud{
+		Points:   []Point{},
+		HasColor: hm.Colors != nil,
+	}
+
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			if !hm.Valid(frame, row) {
+				continue
+			}
+
+			x, y, z := hm.PointAt(frame, row)
+			point := Point{
+				X:          x,
+				Y:          y,
+				Z:          z,
+				Confidence: hm.ConfidenceAt(frame, row),
+			}
+			if pc.HasColor {
+				point.Color = hm.Colors[frame][row]
+			}
+			pc.Points = append(pc.Points, point)
+		}
+	}
+
+	return pc
+}
+
+// FromProfiles converts per-frame profiles into a point cloud. The options
+// define the rows and their spacing, the frame positions are taken from the
+// frames.
+func FromProfiles(frames []Frame, options heightmap.Options) (*PointCloud, error) {
+	hm, err := heightmap.New(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create height map: %w", err)
+	}
+
+	for i, frame := range frames {
+		if err := hm.AddFrameProfileAt(frame.Profile, frame.Image, frame.Position); err != nil {
+			return nil, fmt.Errorf("failed to add frame %d: %w", i, err)
+		}
+	}
+
+	return FromHeightMap(hm), nil
+}
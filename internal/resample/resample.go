@@ -0,0 +1,245 @@
+package resample
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/pointcloud"
+)
+
+type Method string
+
+const (
+	Nearest         Method = "nearest"
+	Bilinear        Method = "bilinear"
+	InverseDistance Method = "idw"
+)
+
+// Options define the uniform grid and how it is filled. The X-axis of the
+// grid is the feed direction, the Y-axis runs along the laser line.
+type Options struct {
+	OriginX, OriginY   float64 // position of the first grid point in mm
+	SpacingX, SpacingY float64 // distance between two grid points in mm
+	CountX, CountY     int     // number of grid points, 0 to cover the whole input starting at its edge (the origin is ignored then)
+	Method             Method
+	MaxRadius          float64 // grid points without a sample within this distance in mm stay NaN
+	Power              float64 // power of the inverse distance weighting
+}
+
+func NewOptions() Options {
+	return Options{
+		SpacingX:  0.1,
+		SpacingY:  0.1,
+		Method:    Bilinear,
+		MaxRadius: 0.5,
+		Power:     2,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.SpacingX <= 0 || o.SpacingY <= 0 {
+		return fmt.Errorf("the grid spacing needs to be greater than 0 but is %f x %f", o.SpacingX, o.SpacingY)
+	}
+	if o.CountX < 0 || o.CountY < 0 {
+		return fmt.Errorf("the number of grid points can not be negative but is %d x %d", o.CountX, o.CountY)
+	}
+	if o.Method != Nearest && o.Method != Bilinear && o.Method != InverseDistance {
+		return fmt.Errorf("Method \"%s\" is invalid. Valid Values are: %s, %s, %s", o.Method, Nearest, Bilinear, InverseDistance)
+	}
+	if o.MaxRadius <= 0 {
+		return fmt.Errorf("MaxRadius needs to be greater than 0 but is %f", o.MaxRadius)
+	}
+	if o.Method == InverseDistance && o.Power <= 0 {
+		return fmt.Errorf("Power needs to be greater than 0 but is %f", o.Power)
+	}
+
+	return nil
+}
+
+// HeightMap resamples a height map onto the uniform grid. The result is a
+// height map with one frame per grid column. Every method takes the cells at
+// the position of their frame like HeightAt, lateral offsets are ignored and
+// need to be moved onto the grid with ResampleLateral first. Use Points with
+// a point cloud to resample the measured positions.
+func HeightMap(hm *heightmap.HeightMap, options Options) (*heightmap.HeightMap, error) {
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	pc := &pointcloud.PointCloud{Points: []pointcloud.Point{}}
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			if hm.Valid(frame, row) {
+				pc.Points = append(pc.Points, pointcloud.Point{X: hm.FrameToMM(frame), Y: hm.RowToMM(row), Z: hm.At(frame, row)})
+			}
+		}
+	}
+	if options.Method != Bilinear {
+		return resamplePoints(pc, options)
+	}
+
+	minX, minY, maxX, maxY := hm.Bounds()
+	options = options.fit(minX, minY, maxX, maxY)
+	index := newGridIndex(pc.Points, options.MaxRadius)
+
+	return fill(options, func(x, y float64) float64 {
+		// bilinear interpolation only uses the direct neighbours, so the
+		// radius only has to keep it from bridging gaps in the scan
+		if _, dist := index.nearest(x, y); dist > options.MaxRadius {
+			return math.NaN()
+		}
+
+		return hm.HeightAt(x, y)
+	})
+}
+
+// Points resamples a point cloud onto the uniform grid. Scattered points have
+// no grid to interpolate on, so only nearest and inverse distance weighting
+// are supported.
+func Points(pc *pointcloud.PointCloud, options Options) (*heightmap.HeightMap, error) {
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+	if options.Method == Bilinear {
+		return nil, fmt.Errorf("bilinear resampling needs the grid of a height map, use %s or %s for point clouds", Nearest, InverseDistance)
+	}
+
+	return resamplePoints(pc, options)
+}
+
+func resamplePoints(pc *pointcloud.PointCloud, options Options) (*heightmap.HeightMap, error) {
+	if len(pc.Points) == 0 {
+		return nil, fmt.Errorf("there are no points to resample")
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range pc.Points {
+		minX, maxX = math.Min(minX, p.X), math.Max(maxX, p.X)
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+	options = options.fit(minX, minY, maxX, maxY)
+	index := newGridIndex(pc.Points, options.MaxRadius)
+
+	if options.Method == Nearest {
+		return fill(options, func(x, y float64) float64 {
+			p, dist := index.nearest(x, y)
+			if dist > options.MaxRadius {
+				return math.NaN()
+			}
+
+			return p.Z
+		})
+	}
+
+	return fill(options, func(x, y float64) float64 {
+		sum, weights := 0.0, 0.0
+		for _, p := range index.within(x, y, options.MaxRadius) {
+			dist := math.Hypot(p.X-x, p.Y-y)
+			if dist == 0 {
+				return p.Z
+			}
+			w := 1 / math.Pow(dist, options.Power)
+			sum += w * p.Z
+			weights += w
+		}
+		if weights == 0 {
+			return math.NaN()
+		}
+
+		return sum / weights
+	})
+}
+
+// fills the grid with the counts that cover the given area if no counts were set
+func (o Options) fit(minX, minY, maxX, maxY float64) Options {
+	if o.CountX == 0 {
+		o.OriginX = minX
+		o.CountX = int(math.Floor((maxX-minX)/o.SpacingX+1e-9)) + 1
+	}
+	if o.CountY == 0 {
+		o.OriginY = minY
+		o.CountY = int(math.Floor((maxY-minY)/o.SpacingY+1e-9)) + 1
+	}
+
+	return o
+}
+
+func fill(options Options, heightAt func(x, y float64) float64) (*heightmap.HeightMap, error) {
+	hmOptions := heightmap.NewOptions()
+	hmOptions.Rows = options.CountY
+	hmOptions.FeedPerFrame = options.SpacingX
+	hmOptions.RowSpacing = options.SpacingY
+	hmOptions.RowOffset = options.OriginY
+
+	result, err := heightmap.New(hmOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create height map: %w", err)
+	}
+
+	heights := make([]float64, options.CountY)
+	for ix := range options.CountX {
+		x := options.OriginX + float64(ix)*options.SpacingX
+		for iy := range options.CountY {
+			heights[iy] = heightAt(x, options.OriginY+float64(iy)*options.SpacingY)
+		}
+		if err := result.AddHeightsAt(heights, x); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// gridIndex buckets points into square cells to find neighbours quickly
+type gridIndex struct {
+	cellSize float64
+	cells    map[[2]int][]pointcloud.Point
+}
+
+func newGridIndex(points []pointcloud.Point, cellSize float64) *gridIndex {
+	index := &gridIndex{cellSize: cellSize, cells: map[[2]int][]pointcloud.Point{}}
+	for _, p := range points {
+		key := index.key(p.X, p.Y)
+		index.cells[key] = append(index.cells[key], p)
+	}
+
+	return index
+}
+
+func (g *gridIndex) key(x, y float64) [2]int {
+	return [2]int{int(math.Floor(x / g.cellSize)), int(math.Floor(y / g.cellSize))}
+}
+
+// within returns all points with a distance of at most radius
+func (g *gridIndex) within(x, y float64, radius float64) []pointcloud.Point {
+	result := []pointcloud.Point{}
+	r := int(math.Ceil(radius / g.cellSize))
+	center := g.key(x, y)
+	for cx := center[0] - r; cx <= center[0]+r; cx++ {
+		for cy := center[1] - r; cy <= center[1]+r; cy++ {
+			for _, p := range g.cells[[2]int{cx, cy}] {
+				if math.Hypot(p.X-x, p.Y-y) <= radius {
+					result = append(result, p)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// nearest returns the closest point within one cell size, the distance is
+// infinite if there is none
+func (g *gridIndex) nearest(x, y float64) (pointcloud.Point, float64) {
+	best := pointcloud.Point{}
+	bestDist := math.Inf(1)
+	for _, p := range g.within(x, y, g.cellSize) {
+		if dist := math.Hypot(p.X-x, p.Y-y); dist < bestDist {
+			best, bestDist = p, dist
+		}
+	}
+
+	return best, bestDist
+}
@@ -0,0 +1,100 @@
+package resample
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/frameprocessor"
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+func TestHeightMap(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 3
+	options.FeedPerFrame = 2
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the third frame follows a gap of 8mm
+	for i, profile := range []map[int]float64{
+		{0: 0, 1: 2, 2: 4},
+		{0: 2, 1: 4, 2: 6},
+		{0: 2, 1: 4, 2: 6},
+	} {
+		if err := hm.AddProfileAt(profile, []float64{0, 2, 10}[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method Method
+		x, y   float64
+		want   float64
+	}{
+		{name: "nearest on a sample", method: Nearest, x: 2, y: 1, want: 4},
+		{name: "nearest between samples", method: Nearest, x: 1.5, y: 1, want: 4},
+		{name: "bilinear between samples", method: Bilinear, x: 0.5, y: 1.5, want: 3.5},
+		{name: "idw between two samples", method: InverseDistance, x: 1, y: 1, want: 3},
+		{name: "gap stays NaN for nearest", method: Nearest, x: 6, y: 1, want: math.NaN()},
+		{name: "gap stays NaN for bilinear", method: Bilinear, x: 6, y: 1, want: math.NaN()},
+		{name: "gap stays NaN for idw", method: InverseDistance, x: 6, y: 1, want: math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewOptions()
+			options.Method = tt.method
+			options.MaxRadius = 1
+			options.SpacingX = 0.5
+			options.SpacingY = 0.5
+
+			got, err := HeightMap(hm, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Frames() != 21 || got.Rows() != 5 {
+				t.Fatalf("HeightMap() has %d x %d cells, want 21 x 5", got.Frames(), got.Rows())
+			}
+
+			h := got.At(int(tt.x/0.5), int(tt.y/0.5))
+			if math.IsNaN(tt.want) != math.IsNaN(h) || (!math.IsNaN(h) && math.Abs(h-tt.want) > 1e-9) {
+				t.Errorf("height at %f,%f = %f, want %f", tt.x, tt.y, h, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeightMapLateral(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 2
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every line was seen 0.4mm after its frame position
+	for frame := range 3 {
+		profile := frameprocessor.Profile{Rows: []frameprocessor.RowResult{
+			{Row: 0, Height: float64(frame), Status: frameprocessor.StatusMeasured, Lateral: 0.4},
+			{Row: 1, Height: float64(frame), Status: frameprocessor.StatusMeasured, Lateral: 0.4},
+		}}
+		if err := hm.AddFrameProfileAt(profile, nil, float64(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// all methods take the cells at their frame position
+	for _, method := range []Method{Nearest, Bilinear, InverseDistance} {
+		options := NewOptions()
+		options.Method = method
+		options.SpacingX = 1
+		options.SpacingY = 1
+		got, err := HeightMap(hm, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.FrameToMM(1) != 1 || got.At(1, 0) != 1 {
+			t.Errorf("%s resampled frame 1 at %f with height %f, want 1 with height 1", method, got.FrameToMM(1), got.At(1, 0))
+		}
+	}
+}
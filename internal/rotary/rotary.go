@@ -0,0 +1,183 @@
+package rotary
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/mesh"
+	"github.com/Neokil/ltp/internal/pointcloud"
+)
+
+// Options describe how a scan on a rotary table is reconstructed. The frame
+// positions of the height map are the angles of the table in degrees, the rows
+// run along the rotation axis.
+type Options struct {
+	AxisOffset float64 // distance from the rotation axis to height 0 in mm, the radius of a cell is its height plus this offset
+	MaxGap     float64 // largest angle in degrees between the last and the first frame of a turn that is still closed
+}
+
+func NewOptions() Options {
+	return Options{
+		AxisOffset: 0,
+		MaxGap:     5,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.AxisOffset < 0 {
+		return fmt.Errorf("AxisOffset needs to be at least 0 but is %f", o.AxisOffset)
+	}
+	if o.MaxGap <= 0 || o.MaxGap >= 360 {
+		return fmt.Errorf("MaxGap needs to be between 0 and 360 but is %f", o.MaxGap)
+	}
+
+	return nil
+}
+
+// ToCartesian converts a measurement at the given table angle in degrees,
+// position along the axis and height into Cartesian coordinates. The axis
+// runs along Y, at angle 0 the point lies straight above the axis on Z.
+func ToCartesian(angle float64, position float64, height float64, options Options) mesh.Vec3 {
+	radius := height + options.AxisOffset
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+
+	return mesh.Vec3{X: radius * sin, Y: position, Z: radius * cos}
+}
+
+// Turn returns the frames of the first full turn sorted by their angle and
+// whether the gap between the last and the first of them is small enough for
+// the turn to be closed. Frames that repeat angles of the first turn are left
+// out.
+func Turn(hm *heightmap.HeightMap, options Options) ([]int, bool, error) {
+	if err := options.Validate(); err != nil {
+		return nil, false, fmt.Errorf("failed to validate options: %w", err)
+	}
+	if hm.Frames() < 3 {
+		return nil, false, fmt.Errorf("a turn needs at least 3 frames but the height map has %d", hm.Frames())
+	}
+
+	first := hm.FrameToMM(0)
+	direction := 1.0
+	if hm.FrameToMM(hm.Frames()-1) < first {
+		direction = -1
+	}
+	frames := []int{}
+	for frame := range hm.Frames() {
+		angle := direction * (hm.FrameToMM(frame) - first)
+		if angle < 0 || angle >= 360 {
+			continue
+		}
+		frames = append(frames, frame)
+	}
+	sort.SliceStable(frames, func(i, j int) bool {
+		return direction*hm.FrameToMM(frames[i]) < direction*hm.FrameToMM(frames[j])
+	})
+
+	gap := 360 - direction*(hm.FrameToMM(frames[len(frames)-1])-first)
+
+	return frames, gap <= options.MaxGap, nil
+}
+
+// PointCloud converts every valid cell of the first turn into a point around
+// the rotation axis.
+func PointCloud(hm *heightmap.HeightMap, options Options) (*pointcloud.PointCloud, error) {
+	frames, _, err := Turn(hm, options)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &pointcloud.PointCloud{Points: []pointcloud.Point{}, HasColor: hm.Colors != nil}
+	for _, frame := range frames {
+		for row := range hm.Rows() {
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			v := ToCartesian(hm.FrameToMM(frame), hm.RowToMM(row), hm.At(frame, row), options)
+			p := pointcloud.Point{X: v.X, Y: v.Y, Z: v.Z, Confidence: hm.ConfidenceAt(frame, row)}
+			if pc.HasColor {
+				p.Color = hm.Colors[frame][row]
+			}
+			pc.Points = append(pc.Points, p)
+		}
+	}
+
+	return pc, nil
+}
+
+// Mesh triangulates the first turn like mesh.FromHeightMap triangulates a flat
+// scan and connects the last frame with the first, so the surface is closed
+// around the axis. The normals point away from the axis. It fails if the
+// frames do not cover a full turn.
+func Mesh(hm *heightmap.HeightMap, options Options) (*mesh.Mesh, error) {
+	frames, closed, err := Turn(hm, options)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		last := hm.FrameToMM(frames[len(frames)-1])
+		return nil, fmt.Errorf("the frames cover only %.1f° of the turn, the gap to 360° needs to be at most %g°", math.Abs(last-hm.FrameToMM(frames[0])), options.MaxGap)
+	}
+	if hm.Rows() < 2 {
+		return nil, fmt.Errorf("a mesh needs at least 2 rows but the height map has %d", hm.Rows())
+	}
+
+	m := &mesh.Mesh{Vertices: []mesh.Vec3{}, Triangles: []mesh.Triangle{}}
+	indices := make([][]int, len(frames))
+	for i, frame := range frames {
+		indices[i] = make([]int, hm.Rows())
+		for row := range indices[i] {
+			indices[i][row] = -1
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			if hm.At(frame, row)+options.AxisOffset < 0 {
+				return nil, fmt.Errorf("frame %d row %d is %f mm below the axis, AxisOffset needs to be larger", frame, row, -(hm.At(frame, row) + options.AxisOffset))
+			}
+			indices[i][row] = len(m.Vertices)
+			m.Vertices = append(m.Vertices, ToCartesian(hm.FrameToMM(frame), hm.RowToMM(row), hm.At(frame, row), options))
+		}
+	}
+
+	add := func(a, b, c int) {
+		m.Triangles = append(m.Triangles, outward(m, a, b, c))
+	}
+	for i := range indices {
+		next := (i + 1) % len(indices)
+		for row := 0; row < hm.Rows()-1; row++ {
+			a := indices[i][row]
+			b := indices[next][row]
+			c := indices[next][row+1]
+			d := indices[i][row+1]
+
+			switch {
+			case a >= 0 && b >= 0 && c >= 0 && d >= 0:
+				add(a, b, c)
+				add(a, c, d)
+			case b >= 0 && c >= 0 && d >= 0:
+				add(b, c, d)
+			case a >= 0 && c >= 0 && d >= 0:
+				add(a, c, d)
+			case a >= 0 && b >= 0 && d >= 0:
+				add(a, b, d)
+			case a >= 0 && b >= 0 && c >= 0:
+				add(a, b, c)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// returns the triangle wound so that its normal points away from the axis
+func outward(m *mesh.Mesh, a, b, c int) mesh.Triangle {
+	va, vb, vc := m.Vertices[a], m.Vertices[b], m.Vertices[c]
+	n := vb.Sub(va).Cross(vc.Sub(va))
+	center := va.Add(vb).Add(vc).Scale(1.0 / 3)
+	if n.X*center.X+n.Z*center.Z < 0 {
+		b, c = c, b
+	}
+
+	return mesh.Triangle{a, b, c}
+}
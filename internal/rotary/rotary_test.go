@@ -0,0 +1,86 @@
+package rotary
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// a cylinder with a radius of 10mm scanned with the given number of frames at
+// the step in degrees, the axis is 8mm below height 0
+func newCylinder(t *testing.T, frames int, step float64) *heightmap.HeightMap {
+	options := heightmap.NewOptions()
+	options.Rows = 5
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for frame := range frames {
+		if err := hm.AddProfileAt(map[int]float64{0: 2, 1: 2, 2: 2, 3: 2, 4: 2}, float64(frame)*step); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return hm
+}
+
+func TestMesh(t *testing.T) {
+	tests := []struct {
+		name      string
+		frames    int
+		step      float64
+		wantTurn  int
+		wantClose bool
+	}{
+		{name: "full turn", frames: 36, step: 10, wantTurn: 36, wantClose: true},
+		{name: "more than a turn", frames: 40, step: 10, wantTurn: 36, wantClose: true},
+		{name: "reverse rotation", frames: 36, step: -10, wantTurn: 36, wantClose: true},
+		{name: "half turn", frames: 18, step: 10, wantTurn: 18, wantClose: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hm := newCylinder(t, tt.frames, tt.step)
+			options := Options{AxisOffset: 8, MaxGap: 15}
+
+			frames, closed, err := Turn(hm, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != tt.wantTurn || closed != tt.wantClose {
+				t.Fatalf("Turn() = %d frames, closed %t, want %d frames, closed %t", len(frames), closed, tt.wantTurn, tt.wantClose)
+			}
+
+			pc, err := PointCloud(hm, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pc.Points) != tt.wantTurn*5 {
+				t.Errorf("PointCloud() has %d points, want %d", len(pc.Points), tt.wantTurn*5)
+			}
+			for _, p := range pc.Points {
+				if r := math.Hypot(p.X, p.Z); math.Abs(r-10) > 1e-9 {
+					t.Fatalf("point %+v has a radius of %f, want 10", p, r)
+				}
+			}
+
+			m, err := Mesh(hm, options)
+			if (err != nil) == tt.wantClose {
+				t.Fatalf("Mesh() error = %v, want an error %t", err, !tt.wantClose)
+			}
+			if err != nil {
+				return
+			}
+			if len(m.Triangles) != tt.wantTurn*4*2 {
+				t.Errorf("Mesh() has %d triangles, want %d", len(m.Triangles), tt.wantTurn*4*2)
+			}
+			for i := range m.Triangles {
+				n := m.Normal(i)
+				v := m.Vertices[m.Triangles[i][0]]
+				if n.X*v.X+n.Z*v.Z <= 0 {
+					t.Fatalf("triangle %d points towards the axis", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package section
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type MeasurementType string
+
+const (
+	StepMeasurement   MeasurementType = "step"
+	GrooveMeasurement MeasurementType = "groove"
+	GapMeasurement    MeasurementType = "gap"
+	AngleMeasurement  MeasurementType = "angle"
+	LineMeasurement   MeasurementType = "line"
+	CircleMeasurement MeasurementType = "circle"
+)
+
+// Definition describes one measurement on a profile. A and B are ranges along
+// the laser line in mm given as [from, to]. Line and circle fits only use A.
+type Definition struct {
+	Name      string          `json:"name"`
+	Type      MeasurementType `json:"type"`
+	A         [2]float64      `json:"a"`
+	B         [2]float64      `json:"b,omitempty"`
+	Level     float64         `json:"level,omitempty"`     // groove: share of the depth at which the width is measured
+	Tolerance float64         `json:"tolerance,omitempty"` // gap: maximum distance of a sample to its surface in mm
+}
+
+func (d Definition) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("the measurement needs a name")
+	}
+	switch d.Type {
+	case StepMeasurement, GrooveMeasurement, AngleMeasurement, LineMeasurement, CircleMeasurement:
+	case GapMeasurement:
+		if d.Tolerance <= 0 {
+			return fmt.Errorf("tolerance of \"%s\" needs to be greater than 0 but is %f", d.Name, d.Tolerance)
+		}
+	default:
+		return fmt.Errorf("type \"%s\" of \"%s\" is invalid. Valid types are: step, groove, gap, angle, line, circle", d.Type, d.Name)
+	}
+
+	return nil
+}
+
+// LoadDefinitions reads a JSON list of measurement definitions.
+func LoadDefinitions(filename string) ([]Definition, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open definitions: %w", err)
+	}
+	defer f.Close()
+
+	definitions := []Definition{}
+	if err := json.NewDecoder(f).Decode(&definitions); err != nil {
+		return nil, fmt.Errorf("failed to read definitions: %w", err)
+	}
+	for _, d := range definitions {
+		if err := d.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return definitions, nil
+}
+
+// Result holds the values of a measurement in mm and degrees. Error is set
+// instead if the measurement failed on this profile.
+type Result struct {
+	Name   string             `json:"name"`
+	Type   MeasurementType    `json:"type"`
+	Values map[string]float64 `json:"values,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+// Measure runs the measurement on the profile.
+func (d Definition) Measure(p Profile) Result {
+	values, err := d.measure(p)
+	result := Result{Name: d.Name, Type: d.Type, Values: values}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func (d Definition) measure(p Profile) (map[string]float64, error) {
+	a := Range{From: d.A[0], To: d.A[1]}
+	b := Range{From: d.B[0], To: d.B[1]}
+
+	switch d.Type {
+	case StepMeasurement:
+		h, err := StepHeight(p, a, b)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"height": h}, nil
+	case GrooveMeasurement:
+		g, err := MeasureGroove(p, a, b, d.Level)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"width": g.Width, "depth": g.Depth, "bottom": g.Bottom}, nil
+	case GapMeasurement:
+		g, err := MeasureGap(p, a, b, d.Tolerance)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"gap": g.Width, "mismatch": g.Mismatch}, nil
+	case AngleMeasurement:
+		angle, err := EdgeAngle(p, a, b)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"angle": angle}, nil
+	case LineMeasurement:
+		l, err := FitLine(p.Segment(a))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"slope": l.Slope, "intercept": l.Intercept, "angle": l.AngleDegrees(), "rms": l.RMS}, nil
+	case CircleMeasurement:
+		c, err := FitCircle(p.Segment(a))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]float64{"radius": c.Radius, "center": c.Center, "center_height": c.CenterHeight, "rms": c.RMS}, nil
+	}
+
+	return nil, fmt.Errorf("type \"%s\" is invalid", d.Type)
+}
@@ -0,0 +1,328 @@
+package section
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/linalg"
+)
+
+// Profile is a cross-section along the laser line. Position is the position of
+// every sample along the line in mm, Height its height in mm. Samples are
+// sorted by position.
+type Profile struct {
+	Position []float64
+	Height   []float64
+}
+
+// FromHeightMap returns the measured cells of a frame as profile, cells filled
+// by FillHoles are left out.
+func FromHeightMap(hm *heightmap.HeightMap, frame int) Profile {
+	p := Profile{}
+	for row := range hm.Rows() {
+		if !hm.Measured(frame, row) {
+			continue
+		}
+		p.Position = append(p.Position, hm.RowToMM(row))
+		p.Height = append(p.Height, hm.At(frame, row))
+	}
+	sort.Sort(byPosition(p))
+
+	return p
+}
+
+type byPosition Profile
+
+func (p byPosition) Len() int           { return len(p.Position) }
+func (p byPosition) Less(i, j int) bool { return p.Position[i] < p.Position[j] }
+func (p byPosition) Swap(i, j int) {
+	p.Position[i], p.Position[j] = p.Position[j], p.Position[i]
+	p.Height[i], p.Height[j] = p.Height[j], p.Height[i]
+}
+
+func (p Profile) Len() int {
+	return len(p.Position)
+}
+
+// Range selects the samples between From and To in mm, both inclusive.
+type Range struct {
+	From float64
+	To   float64
+}
+
+func (r Range) Contains(position float64) bool {
+	return position >= math.Min(r.From, r.To) && position <= math.Max(r.From, r.To)
+}
+
+// Segment returns the samples within the range.
+func (p Profile) Segment(r Range) Profile {
+	s := Profile{}
+	for i, pos := range p.Position {
+		if r.Contains(pos) {
+			s.Position = append(s.Position, pos)
+			s.Height = append(s.Height, p.Height[i])
+		}
+	}
+
+	return s
+}
+
+// Line is height = Slope*position + Intercept.
+type Line struct {
+	Slope     float64
+	Intercept float64
+	RMS       float64 // root mean square of the residuals in mm
+}
+
+func (l Line) At(position float64) float64 {
+	return l.Slope*position + l.Intercept
+}
+
+// AngleDegrees returns the angle of the line to the plate.
+func (l Line) AngleDegrees() float64 {
+	return math.Atan(l.Slope) * 180 / math.Pi
+}
+
+// FitLine fits a line to the samples by least squares.
+func FitLine(p Profile) (Line, error) {
+	if p.Len() < 2 {
+		return Line{}, fmt.Errorf("need at least 2 samples to fit a line but got %d", p.Len())
+	}
+
+	var sx, sy, sxx, sxy float64
+	for i, x := range p.Position {
+		y := p.Height[i]
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	n := float64(p.Len())
+	d := n*sxx - sx*sx
+	if math.Abs(d) < 1e-12 {
+		return Line{}, fmt.Errorf("all samples are at the same position, can not fit a line")
+	}
+
+	l := Line{Slope: (n*sxy - sx*sy) / d}
+	l.Intercept = (sy - l.Slope*sx) / n
+	l.RMS = rms(p, l.At)
+
+	return l, nil
+}
+
+// Circle is an arc in the cross-section, Center is its position along the line
+// and CenterHeight its height.
+type Circle struct {
+	Center       float64
+	CenterHeight float64
+	Radius       float64
+	RMS          float64 // root mean square of the radial residuals in mm
+}
+
+// FitCircle fits a circle to the samples by minimizing the algebraic distance,
+// which is exact for samples on a circle and needs no start values.
+func FitCircle(p Profile) (Circle, error) {
+	if p.Len() < 3 {
+		return Circle{}, fmt.Errorf("need at least 3 samples to fit a circle but got %d", p.Len())
+	}
+
+	// x² + y² + D*x + E*y + F = 0
+	m := [][]float64{make([]float64, 3), make([]float64, 3), make([]float64, 3)}
+	v := make([]float64, 3)
+	for i, x := range p.Position {
+		y := p.Height[i]
+		row := []float64{x, y, 1}
+		rhs := -(x*x + y*y)
+		for a := range 3 {
+			for b := range 3 {
+				m[a][b] += row[a] * row[b]
+			}
+			v[a] += row[a] * rhs
+		}
+	}
+	solution, ok := linalg.Solve(m, v)
+	if !ok {
+		return Circle{}, fmt.Errorf("the samples are collinear, can not fit a circle")
+	}
+
+	c := Circle{Center: -solution[0] / 2, CenterHeight: -solution[1] / 2}
+	r2 := c.Center*c.Center + c.CenterHeight*c.CenterHeight - solution[2]
+	if r2 <= 0 {
+		return Circle{}, fmt.Errorf("the samples do not describe a circle")
+	}
+	c.Radius = math.Sqrt(r2)
+
+	sum := 0.0
+	for i, x := range p.Position {
+		d := math.Hypot(x-c.Center, p.Height[i]-c.CenterHeight) - c.Radius
+		sum += d * d
+	}
+	c.RMS = math.Sqrt(sum / float64(p.Len()))
+
+	return c, nil
+}
+
+// StepHeight fits a line to the reference range and returns the mean height of
+// the samples in the other range above that line.
+func StepHeight(p Profile, reference Range, step Range) (float64, error) {
+	line, err := FitLine(p.Segment(reference))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fit reference line: %w", err)
+	}
+	s := p.Segment(step)
+	if s.Len() == 0 {
+		return 0, fmt.Errorf("no samples in the step range")
+	}
+
+	sum := 0.0
+	for i, pos := range s.Position {
+		sum += s.Height[i] - line.At(pos)
+	}
+
+	return sum / float64(s.Len()), nil
+}
+
+// Groove describes a groove between two surfaces.
+type Groove struct {
+	Width  float64 // width at the given level of the depth
+	Depth  float64 // depth of the deepest sample below the surface
+	Bottom float64 // position of the deepest sample
+}
+
+// MeasureGroove fits the surface through the samples in left and right and
+// measures the groove between them. The width is taken where the profile
+// crosses level times the depth below the surface, so 0 measures at the
+// surface and 0.5 at half the depth.
+func MeasureGroove(p Profile, left Range, right Range, level float64) (Groove, error) {
+	if level < 0 || level >= 1 {
+		return Groove{}, fmt.Errorf("level needs to be at least 0 and less than 1 but is %f", level)
+	}
+
+	surfaceSamples := p.Segment(left)
+	r := p.Segment(right)
+	surfaceSamples.Position = append(surfaceSamples.Position, r.Position...)
+	surfaceSamples.Height = append(surfaceSamples.Height, r.Height...)
+	surface, err := FitLine(surfaceSamples)
+	if err != nil {
+		return Groove{}, fmt.Errorf("failed to fit surface: %w", err)
+	}
+
+	from, to := rangeBetween(left, right)
+	bottom := -1
+	depth := 0.0
+	for i, pos := range p.Position {
+		if pos <= from || pos >= to {
+			continue
+		}
+		if d := surface.At(pos) - p.Height[i]; d > depth {
+			depth = d
+			bottom = i
+		}
+	}
+	if bottom < 0 {
+		return Groove{}, fmt.Errorf("no samples below the surface between the ranges")
+	}
+
+	// walks from the bottom to both sides until the profile is above the level
+	threshold := level * depth
+	below := func(i int) float64 {
+		return surface.At(p.Position[i]) - p.Height[i] - threshold
+	}
+	crossing := func(step int) (float64, error) {
+		for i := bottom; i+step >= 0 && i+step < p.Len(); i += step {
+			if b := below(i + step); b <= 0 {
+				// interpolate between the last sample below and the first above
+				a := below(i)
+				return p.Position[i] + (p.Position[i+step]-p.Position[i])*a/(a-b), nil
+			}
+		}
+		return 0, fmt.Errorf("the groove has no edge on one side")
+	}
+	leftEdge, err := crossing(-1)
+	if err != nil {
+		return Groove{}, err
+	}
+	rightEdge, err := crossing(1)
+	if err != nil {
+		return Groove{}, err
+	}
+
+	return Groove{Width: rightEdge - leftEdge, Depth: depth, Bottom: p.Position[bottom]}, nil
+}
+
+// Gap describes the gap between two surfaces, for example two plates before
+// welding.
+type Gap struct {
+	Width    float64 // distance between the ends of the surfaces
+	Mismatch float64 // height of the right surface above the left one in the middle of the gap
+}
+
+// MeasureGap fits a line to each surface and follows it towards the other
+// surface as long as the samples are within tolerance of the line. The gap is
+// the distance between the last samples of both surfaces.
+func MeasureGap(p Profile, left Range, right Range, tolerance float64) (Gap, error) {
+	leftLine, err := FitLine(p.Segment(left))
+	if err != nil {
+		return Gap{}, fmt.Errorf("failed to fit left surface: %w", err)
+	}
+	rightLine, err := FitLine(p.Segment(right))
+	if err != nil {
+		return Gap{}, fmt.Errorf("failed to fit right surface: %w", err)
+	}
+
+	from, to := rangeBetween(left, right)
+	leftEnd := math.Inf(-1)
+	for i, pos := range p.Position {
+		if pos > to || (pos > from && math.Abs(p.Height[i]-leftLine.At(pos)) > tolerance) {
+			break
+		}
+		leftEnd = pos
+	}
+	rightEnd := math.Inf(1)
+	for i := p.Len() - 1; i >= 0; i-- {
+		pos := p.Position[i]
+		if pos < from || (pos < to && math.Abs(p.Height[i]-rightLine.At(pos)) > tolerance) {
+			break
+		}
+		rightEnd = pos
+	}
+	if math.IsInf(leftEnd, 0) || math.IsInf(rightEnd, 0) || rightEnd < leftEnd {
+		return Gap{}, fmt.Errorf("the surfaces do not end between the ranges")
+	}
+
+	middle := (leftEnd + rightEnd) / 2
+
+	return Gap{Width: rightEnd - leftEnd, Mismatch: rightLine.At(middle) - leftLine.At(middle)}, nil
+}
+
+// EdgeAngle returns the angle in degrees from the line through the first range
+// to the line through the second range, positive is counterclockwise.
+func EdgeAngle(p Profile, first Range, second Range) (float64, error) {
+	a, err := FitLine(p.Segment(first))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fit first line: %w", err)
+	}
+	b, err := FitLine(p.Segment(second))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fit second line: %w", err)
+	}
+
+	return b.AngleDegrees() - a.AngleDegrees(), nil
+}
+
+// returns the end of the left range and the start of the right range
+func rangeBetween(left Range, right Range) (float64, float64) {
+	return math.Max(left.From, left.To), math.Min(right.From, right.To)
+}
+
+func rms(p Profile, f func(float64) float64) float64 {
+	sum := 0.0
+	for i, pos := range p.Position {
+		d := p.Height[i] - f(pos)
+		sum += d * d
+	}
+
+	return math.Sqrt(sum / float64(p.Len()))
+}
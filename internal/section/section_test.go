@@ -0,0 +1,127 @@
+package section
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// samples f every 0.1mm from 0 to 10mm, NaN leaves out the sample
+func newProfile(f func(pos float64) float64) Profile {
+	p := Profile{}
+	for i := 0; i <= 100; i++ {
+		pos := float64(i) / 10
+		h := f(pos)
+		if math.IsNaN(h) {
+			continue
+		}
+		p.Position = append(p.Position, pos)
+		p.Height = append(p.Height, h)
+	}
+
+	return p
+}
+
+func TestFromHeightMap(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 3
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, heights := range [][]float64{{1, 1, 1}, {1, math.NaN(), 1}, {1, 1, 1}} {
+		if err := hm.AddHeightsAt(heights, float64(hm.Frames())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if filled := hm.FillHoles(1); filled != 1 {
+		t.Fatalf("FillHoles() = %d, want 1", filled)
+	}
+
+	p := FromHeightMap(hm, 1)
+	if p.Len() != 2 || p.Position[0] != 0 || p.Position[1] != 2 {
+		t.Errorf("FromHeightMap() = %+v, want the rows 0 and 2 without the filled cell", p)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    Profile
+		definition Definition
+		want       map[string]float64
+	}{
+		{
+			name: "step on a tilted reference",
+			profile: newProfile(func(pos float64) float64 {
+				if pos > 5 {
+					return 2
+				}
+				return 0.1 * pos
+			}),
+			definition: Definition{Type: StepMeasurement, A: [2]float64{0, 4}, B: [2]float64{6, 10}},
+			want:       map[string]float64{"height": 2 - 0.8},
+		},
+		{
+			name:       "groove at surface",
+			profile:    newProfile(func(pos float64) float64 { return -math.Max(0, 1-math.Abs(pos-5)) }),
+			definition: Definition{Type: GrooveMeasurement, A: [2]float64{0, 3}, B: [2]float64{7, 10}},
+			want:       map[string]float64{"width": 2, "depth": 1, "bottom": 5},
+		},
+		{
+			name:       "groove at half depth",
+			profile:    newProfile(func(pos float64) float64 { return -math.Max(0, 1-math.Abs(pos-5)) }),
+			definition: Definition{Type: GrooveMeasurement, A: [2]float64{0, 3}, B: [2]float64{7, 10}, Level: 0.5},
+			want:       map[string]float64{"width": 1, "depth": 1, "bottom": 5},
+		},
+		{
+			name: "gap",
+			profile: newProfile(func(pos float64) float64 {
+				if pos < 4.05 {
+					return 0
+				} else if pos < 5.95 {
+					return math.NaN()
+				}
+				return 0.5
+			}),
+			definition: Definition{Type: GapMeasurement, A: [2]float64{0, 3}, B: [2]float64{7, 10}, Tolerance: 0.1},
+			want:       map[string]float64{"gap": 2, "mismatch": 0.5},
+		},
+		{
+			name:       "angle",
+			profile:    newProfile(func(pos float64) float64 { return math.Max(0, pos-5) }),
+			definition: Definition{Type: AngleMeasurement, A: [2]float64{0, 4}, B: [2]float64{6, 10}},
+			want:       map[string]float64{"angle": 45},
+		},
+		{
+			name:       "line",
+			profile:    newProfile(func(pos float64) float64 { return 0.5*pos + 1 }),
+			definition: Definition{Type: LineMeasurement, A: [2]float64{2, 8}},
+			want:       map[string]float64{"slope": 0.5, "intercept": 1, "angle": math.Atan(0.5) * 180 / math.Pi, "rms": 0},
+		},
+		{
+			name:       "circle",
+			profile:    newProfile(func(pos float64) float64 { return math.Sqrt(math.Max(0, 9-(pos-5)*(pos-5))) - 1 }),
+			definition: Definition{Type: CircleMeasurement, A: [2]float64{3, 7}},
+			want:       map[string]float64{"radius": 3, "center": 5, "center_height": -1, "rms": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.definition.Name = tt.name
+			if err := tt.definition.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			result := tt.definition.Measure(tt.profile)
+			if result.Error != "" {
+				t.Fatal(result.Error)
+			}
+			for key, want := range tt.want {
+				if got := result.Values[key]; math.Abs(got-want) > 1e-6 {
+					t.Errorf("%s = %f, want %f", key, got, want)
+				}
+			}
+		})
+	}
+}
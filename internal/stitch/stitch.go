@@ -0,0 +1,286 @@
+package stitch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Neokil/ltp/internal/compare"
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// Pass is one of several parallel scans of a part that is wider than the
+// field of view of the camera.
+type Pass struct {
+	HeightMap *heightmap.HeightMap
+	OffsetX   float64 // nominal position of the pass in mm, added to the positions of its cells
+	OffsetY   float64
+}
+
+type Options struct {
+	Register     bool               // refine the nominal offsets by registering every pass on its overlap with the previous ones
+	Registration compare.ICPOptions // options of the registration, the rotation is usually not fitted as the passes only move
+	FeatherWidth float64            // distance from the edge of a pass in mm over which its weight rises, so seams blend smoothly
+}
+
+func NewOptions() Options {
+	registration := compare.NewICPOptions()
+	registration.FitRotation = false
+	registration.FitZ = true
+
+	return Options{
+		Register:     true,
+		Registration: registration,
+		FeatherWidth: 2,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.FeatherWidth < 0 {
+		return fmt.Errorf("FeatherWidth needs to be at least 0 but is %f", o.FeatherWidth)
+	}
+	if o.Register {
+		if err := o.Registration.Validate(); err != nil {
+			return fmt.Errorf("failed to validate registration options: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Offset is the registered position of a pass. The pass is rotated around
+// Center before it is moved by X and Y, all in the coordinates of the pass.
+type Offset struct {
+	X               float64 `json:"x"`
+	Y               float64 `json:"y"`
+	Z               float64 `json:"z"`
+	RotationDegrees float64 `json:"rotation_degrees"`
+	CenterX         float64 `json:"center_x"`
+	CenterY         float64 `json:"center_y"`
+}
+
+func (o Offset) alignment() compare.Alignment {
+	return compare.Alignment{X: o.X, Y: o.Y, Z: o.Z, RotationDegrees: o.RotationDegrees, CenterX: o.CenterX, CenterY: o.CenterY}
+}
+
+// returns the position on the pass of a position on the merged height map
+func (o Offset) inverse(x float64, y float64) (float64, float64) {
+	sin, cos := math.Sincos(o.RotationDegrees * math.Pi / 180)
+	dx, dy := x-o.X-o.CenterX, y-o.Y-o.CenterY
+
+	return o.CenterX + cos*dx + sin*dy, o.CenterY - sin*dx + cos*dy
+}
+
+// Seam describes how well a pass fits the passes before it on their overlap.
+type Seam struct {
+	Pass         int     `json:"pass"`
+	Offset       Offset  `json:"offset"`
+	ShiftX       float64 `json:"shift_x"` // registered minus nominal offset
+	ShiftY       float64 `json:"shift_y"`
+	OverlapCells int     `json:"overlap_cells"`
+	OverlapArea  float64 `json:"overlap_area"`
+	RMS          float64 `json:"rms"` // RMS height difference on the overlap after registration
+	MaxDeviation float64 `json:"max_deviation"`
+	// the overlap is too flat to register X and Y, e.g. bare plate, so the
+	// nominal offset was kept and only Z was fitted
+	Unconstrained bool `json:"unconstrained"`
+}
+
+type Result struct {
+	HeightMap *heightmap.HeightMap `json:"-"`
+	Offsets   []Offset             `json:"offsets"`
+	Seams     []Seam               `json:"seams"`
+}
+
+// Stitch merges the passes into a single height map with the row spacing and
+// frame width of the first pass. Every pass after the first is registered
+// against the merge of the passes before it, starting at its nominal offset.
+// Where passes overlap their heights are blended, weighted by the confidence
+// of the cells and the distance to the edge of the pass.
+func Stitch(passes []Pass, options Options) (Result, error) {
+	if err := options.Validate(); err != nil {
+		return Result{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+	if len(passes) == 0 {
+		return Result{}, fmt.Errorf("no passes given")
+	}
+
+	result := Result{Offsets: []Offset{{X: passes[0].OffsetX, Y: passes[0].OffsetY}}, Seams: []Seam{}}
+	for i := 1; i < len(passes); i++ {
+		pass := passes[i]
+		merged, err := merge(passes[:i], result.Offsets, options)
+		if err != nil {
+			return Result{}, err
+		}
+
+		offset := Offset{X: pass.OffsetX, Y: pass.OffsetY}
+		unconstrained := false
+		if options.Register {
+			minX, minY, maxX, maxY := pass.HeightMap.Bounds()
+			start := compare.Alignment{X: offset.X, Y: offset.Y, CenterX: (minX + maxX) / 2, CenterY: (minY + maxY) / 2}
+			alignment, _, err := compare.ICP(pass.HeightMap, merged, start, options.Registration)
+			switch {
+			case errors.Is(err, compare.ErrUnconstrained):
+				unconstrained = true
+				if options.Registration.FitZ {
+					offset.Z = overlapHeight(merged, pass.HeightMap, offset)
+				}
+			case err != nil:
+				return Result{}, fmt.Errorf("failed to register pass %d: %w", i, err)
+			default:
+				offset = Offset{X: alignment.X, Y: alignment.Y, Z: alignment.Z, RotationDegrees: alignment.RotationDegrees, CenterX: alignment.CenterX, CenterY: alignment.CenterY}
+			}
+		}
+		result.Offsets = append(result.Offsets, offset)
+
+		seam := seamResidual(merged, pass.HeightMap, offset)
+		seam.Pass = i
+		seam.Unconstrained = unconstrained
+		seam.ShiftX, seam.ShiftY = offset.X-pass.OffsetX, offset.Y-pass.OffsetY
+		result.Seams = append(result.Seams, seam)
+	}
+
+	merged, err := merge(passes, result.Offsets, options)
+	if err != nil {
+		return Result{}, err
+	}
+	result.HeightMap = merged
+
+	return result, nil
+}
+
+// compares the cells of the pass with the merged height map
+func seamResidual(merged *heightmap.HeightMap, hm *heightmap.HeightMap, offset Offset) Seam {
+	seam := Seam{Offset: offset}
+	alignment := offset.alignment()
+	sum := 0.0
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			h := merged.HeightAt(alignment.Apply(hm.FrameToMM(frame), hm.RowToMM(row)))
+			if math.IsNaN(h) {
+				continue
+			}
+			d := hm.At(frame, row) + offset.Z - h
+			sum += d * d
+			seam.MaxDeviation = math.Max(seam.MaxDeviation, math.Abs(d))
+			seam.OverlapCells++
+			seam.OverlapArea += hm.CellArea(frame)
+		}
+	}
+	if seam.OverlapCells > 0 {
+		seam.RMS = math.Sqrt(sum / float64(seam.OverlapCells))
+	}
+
+	return seam
+}
+
+// returns the mean height of the merged height map above the pass on their
+// overlap
+func overlapHeight(merged *heightmap.HeightMap, hm *heightmap.HeightMap, offset Offset) float64 {
+	alignment := offset.alignment()
+	sum, n := 0.0, 0
+	for frame := range hm.Frames() {
+		for row := range hm.Rows() {
+			if !hm.Valid(frame, row) {
+				continue
+			}
+			h := merged.HeightAt(alignment.Apply(hm.FrameToMM(frame), hm.RowToMM(row)))
+			if math.IsNaN(h) {
+				continue
+			}
+			sum += h - hm.At(frame, row)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+
+	return sum / float64(n)
+}
+
+// resamples the passes at their offsets onto a common grid and blends them
+func merge(passes []Pass, offsets []Offset, options Options) (*heightmap.HeightMap, error) {
+	first := passes[0].HeightMap
+	if first.Frames() == 0 {
+		return nil, fmt.Errorf("pass 0 has no frames")
+	}
+	spacingX, spacingY := first.FrameWidth(0), math.Abs(first.RowSpacing)
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, pass := range passes {
+		if pass.HeightMap.Frames() == 0 {
+			return nil, fmt.Errorf("pass %d has no frames", i)
+		}
+		x0, y0, x1, y1 := pass.HeightMap.Bounds()
+		alignment := offsets[i].alignment()
+		for _, corner := range [][2]float64{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}} {
+			x, y := alignment.Apply(corner[0], corner[1])
+			minX, minY = math.Min(minX, x), math.Min(minY, y)
+			maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+		}
+	}
+
+	hmOptions := heightmap.NewOptions()
+	hmOptions.Rows = int(math.Floor((maxY-minY)/spacingY+1e-9)) + 1
+	hmOptions.FeedPerFrame = spacingX
+	hmOptions.RowSpacing = spacingY
+	hmOptions.RowOffset = minY
+	merged, err := heightmap.New(hmOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create merged height map: %w", err)
+	}
+
+	frames := int(math.Floor((maxX-minX)/spacingX+1e-9)) + 1
+	for frame := range frames {
+		x := minX + float64(frame)*spacingX
+		heights := make([]float64, hmOptions.Rows)
+		confidence := make([]float64, hmOptions.Rows)
+		for row := range heights {
+			y := merged.RowToMM(row)
+			sum, weights, confidences := 0.0, 0.0, 0.0
+			for i, pass := range passes {
+				px, py := offsets[i].inverse(x, y)
+				h := pass.HeightMap.HeightAt(px, py)
+				if math.IsNaN(h) {
+					continue
+				}
+				f, r, _ := pass.HeightMap.CellAt(px, py)
+				c := pass.HeightMap.ConfidenceAt(f, r)
+				w := c * feather(pass.HeightMap, px, py, options.FeatherWidth)
+				sum += w * (h + offsets[i].Z)
+				weights += w
+				confidences += w * c
+			}
+			heights[row] = math.NaN()
+			if weights > 0 {
+				heights[row] = sum / weights
+				confidence[row] = confidences / weights
+			}
+		}
+		if err := merged.AddHeightsAt(heights, x); err != nil {
+			return nil, fmt.Errorf("failed to add frame %d: %w", frame, err)
+		}
+		merged.Confidence[frame] = confidence
+	}
+
+	return merged, nil
+}
+
+// weight of a position by its distance to the edge of the pass, rising from
+// almost 0 at the edge to 1 at the feather width. Positions at the edge keep
+// a small weight, so they still count where no other pass covers them.
+func feather(hm *heightmap.HeightMap, x float64, y float64, width float64) float64 {
+	if width == 0 {
+		return 1
+	}
+
+	minX, minY, maxX, maxY := hm.Bounds()
+	distance := math.Min(math.Min(x-minX, maxX-x), math.Min(y-minY, maxY-y))
+
+	return math.Max(0.01, math.Min(1, distance/width))
+}
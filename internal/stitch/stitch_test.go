@@ -0,0 +1,168 @@
+package stitch
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/compare"
+	"github.com/Neokil/ltp/internal/heightmap"
+)
+
+// bumps along the overlap of the passes, so the registration has something to hold on to
+func surface(x float64, y float64) float64 {
+	h := 0.0
+	for _, b := range [][2]float64{{4, 17}, {10, 16}, {15, 18.5}} {
+		h += math.Exp(-((x-b[0])*(x-b[0]) + (y-b[1])*(y-b[1])) / 3)
+	}
+
+	return h
+}
+
+// samples a 20x20mm pass of the surface that is placed by the alignment and
+// measures a.Z too low
+func newPass(t *testing.T, a compare.Alignment) *heightmap.HeightMap {
+	options := heightmap.NewOptions()
+	options.Rows = 81
+	options.FeedPerFrame = 0.25
+	options.RowSpacing = 0.25
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for frame := range 81 {
+		heights := make([]float64, options.Rows)
+		for row := range heights {
+			heights[row] = surface(a.Apply(float64(frame)*0.25, float64(row)*0.25)) - a.Z
+		}
+		if err := hm.AddHeightsAt(heights, float64(frame)*0.25); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return hm
+}
+
+func TestStitch(t *testing.T) {
+	passes := []Pass{
+		{HeightMap: newPass(t, compare.Alignment{})},
+		{HeightMap: newPass(t, compare.Alignment{X: 0.3, Y: 14.6, Z: 0.05}), OffsetY: 15},
+	}
+
+	tests := []struct {
+		name     string
+		register bool
+		want     Offset
+		maxRMS   float64
+	}{
+		{name: "registered", register: true, want: Offset{X: 0.3, Y: 14.6, Z: 0.05}, maxRMS: 0.01},
+		{name: "nominal offsets", register: false, want: Offset{X: 0, Y: 15, Z: 0}, maxRMS: math.Inf(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := NewOptions()
+			options.Register = tt.register
+			result, err := Stitch(passes, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := result.Offsets[1]
+			if math.Abs(got.X-tt.want.X) > 0.02 || math.Abs(got.Y-tt.want.Y) > 0.02 || math.Abs(got.Z-tt.want.Z) > 0.005 {
+				t.Errorf("Stitch() offset = %+v, want %+v", got, tt.want)
+			}
+			seam := result.Seams[0]
+			if seam.OverlapCells == 0 || seam.RMS > tt.maxRMS {
+				t.Errorf("seam has %d cells with a RMS of %f, want at most %f", seam.OverlapCells, seam.RMS, tt.maxRMS)
+			}
+
+			hm := result.HeightMap
+			if minX, minY, maxX, maxY := hm.Bounds(); minX != 0 || minY != 0 || maxX < 20 || maxY < 34.5 {
+				t.Errorf("merged height map covers %f,%f to %f,%f", minX, minY, maxX, maxY)
+			}
+			if !tt.register {
+				return
+			}
+			for _, p := range [][2]float64{{4, 17}, {10, 16}, {15, 18.5}, {5, 30}} {
+				if got := hm.HeightAt(p[0], p[1]); math.Abs(got-surface(p[0], p[1])) > 0.01 {
+					t.Errorf("merged height at %v is %f, want %f", p, got, surface(p[0], p[1]))
+				}
+			}
+		})
+	}
+}
+
+func TestStitchRotated(t *testing.T) {
+	rotated := compare.Alignment{X: 0.3, Y: 14.6, Z: 0.05, RotationDegrees: 1.5, CenterX: 10, CenterY: 10}
+	passes := []Pass{
+		{HeightMap: newPass(t, compare.Alignment{})},
+		{HeightMap: newPass(t, rotated), OffsetY: 15},
+	}
+
+	options := NewOptions()
+	options.Registration.FitRotation = true
+	result, err := Stitch(passes, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := result.Offsets[1]
+	if math.Abs(got.RotationDegrees-rotated.RotationDegrees) > 0.1 || math.Abs(got.Z-rotated.Z) > 0.005 {
+		t.Errorf("Stitch() offset = %+v, want %+v", got, rotated)
+	}
+	for _, p := range [][2]float64{{0, 0}, {20, 20}} {
+		x, y := got.alignment().Apply(p[0], p[1])
+		wantX, wantY := rotated.Apply(p[0], p[1])
+		if math.Hypot(x-wantX, y-wantY) > 0.05 {
+			t.Errorf("corner %v of the pass is placed at %f,%f, want %f,%f", p, x, y, wantX, wantY)
+		}
+	}
+	if seam := result.Seams[0]; seam.OverlapCells == 0 || seam.RMS > 0.01 {
+		t.Errorf("seam has %d cells with a RMS of %f, want at most 0.01", seam.OverlapCells, seam.RMS)
+	}
+	for _, p := range [][2]float64{{4, 17}, {10, 16}, {15, 18.5}, {5, 30}} {
+		if h := result.HeightMap.HeightAt(p[0], p[1]); math.Abs(h-surface(p[0], p[1])) > 0.01 {
+			t.Errorf("merged height at %v is %f, want %f", p, h, surface(p[0], p[1]))
+		}
+	}
+}
+
+func TestStitchFlatOverlap(t *testing.T) {
+	// bare plate with some noise on the overlap and a bump outside of it
+	plate := func(x float64, y float64) float64 {
+		return 0.01*math.Sin(37*x+11*y) + math.Exp(-((x-10)*(x-10)+(y-30)*(y-30))/3)
+	}
+	newPlatePass := func(y0 float64, z float64) *heightmap.HeightMap {
+		options := heightmap.NewOptions()
+		options.Rows = 81
+		options.FeedPerFrame = 0.25
+		options.RowSpacing = 0.25
+		hm, err := heightmap.New(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for frame := range 81 {
+			heights := make([]float64, options.Rows)
+			for row := range heights {
+				heights[row] = plate(float64(frame)*0.25, y0+float64(row)*0.25) - z
+			}
+			if err := hm.AddHeightsAt(heights, float64(frame)*0.25); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return hm
+	}
+	passes := []Pass{
+		{HeightMap: newPlatePass(0, 0)},
+		{HeightMap: newPlatePass(15, 0.05), OffsetY: 15},
+	}
+
+	result, err := Stitch(passes, NewOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := result.Offsets[1]
+	if got.X != 0 || got.Y != 15 || math.Abs(got.Z-0.05) > 0.005 {
+		t.Errorf("Stitch() offset = %+v, want the nominal 0, 15 with a Z of 0.05", got)
+	}
+	if !result.Seams[0].Unconstrained {
+		t.Errorf("the seam on bare plate should be unconstrained")
+	}
+}
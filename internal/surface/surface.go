@@ -0,0 +1,396 @@
+package surface
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/measure"
+	"github.com/Neokil/ltp/internal/section"
+)
+
+// alpha of the gaussian filter, chosen so the filter transmits 50% at the cutoff
+var gaussianAlpha = math.Sqrt(math.Ln2 / math.Pi)
+
+type Options struct {
+	Cutoff float64 // cutoff wavelength λc of the gaussian filter in mm that separates roughness from waviness, 0 disables the filter
+}
+
+func NewOptions() Options {
+	return Options{
+		Cutoff: 0.8,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.Cutoff < 0 {
+		return fmt.Errorf("Cutoff needs to be at least 0 but is %f", o.Cutoff)
+	}
+
+	return nil
+}
+
+// ProfileParameters are the roughness parameters of a profile in mm.
+type ProfileParameters struct {
+	Ra float64 `json:"ra"` // arithmetic mean deviation
+	Rq float64 `json:"rq"` // root mean square deviation
+	Rz float64 `json:"rz"` // mean of the peak to valley heights of the sampling lengths
+	Rt float64 `json:"rt"` // peak to valley height over the whole profile
+}
+
+// AreaParameters are the areal parameters and the flatness of an area in mm.
+type AreaParameters struct {
+	Name                 string  `json:"name"`
+	Cells                int     `json:"cells"`
+	Sa                   float64 `json:"sa"` // arithmetic mean height
+	Sq                   float64 `json:"sq"` // root mean square height
+	Sz                   float64 `json:"sz"` // maximum height from the lowest pit to the highest peak
+	FlatnessLeastSquares float64 `json:"flatness_least_squares"`
+	FlatnessMinimumZone  float64 `json:"flatness_minimum_zone"`
+}
+
+// Profile computes the roughness parameters of a profile. The form is removed
+// by a least squares line and the waviness by the gaussian filter, Rz uses
+// sampling lengths of λc. With the filter λc/2 at both ends of the profile are
+// not evaluated.
+func Profile(p section.Profile, options Options) (ProfileParameters, error) {
+	if err := options.Validate(); err != nil {
+		return ProfileParameters{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+	line, err := section.FitLine(p)
+	if err != nil {
+		return ProfileParameters{}, fmt.Errorf("failed to remove form: %w", err)
+	}
+
+	r := make([]float64, p.Len())
+	for i, pos := range p.Position {
+		r[i] = p.Height[i] - line.At(pos)
+	}
+	positions := p.Position
+	if options.Cutoff > 0 {
+		waviness := gaussian(p.Position, r, options.Cutoff)
+		for i := range r {
+			r[i] -= waviness[i]
+		}
+
+		// the filter is not reliable within λc/2 of the ends, so they are left
+		// out of the evaluation if the profile is long enough
+		first, last := p.Position[0]+options.Cutoff/2, p.Position[p.Len()-1]-options.Cutoff/2
+		if last-first >= options.Cutoff {
+			evaluated := []float64{}
+			positions = []float64{}
+			for i, pos := range p.Position {
+				if pos >= first && pos <= last {
+					evaluated = append(evaluated, r[i])
+					positions = append(positions, pos)
+				}
+			}
+			if len(evaluated) == 0 {
+				return ProfileParameters{}, fmt.Errorf("the profile has no samples more than λc/2 from its ends")
+			}
+			r = evaluated
+		}
+	}
+
+	params := ProfileParameters{}
+	for _, v := range r {
+		params.Ra += math.Abs(v)
+		params.Rq += v * v
+	}
+	params.Ra /= float64(len(r))
+	params.Rq = math.Sqrt(params.Rq / float64(len(r)))
+	params.Rt = peakToValley(r)
+
+	// Rz is the mean over the complete sampling lengths, a profile shorter than
+	// λc has just one
+	start, length := positions[0], positions[len(positions)-1]-positions[0]
+	samplingLengths := 1
+	if options.Cutoff > 0 && length >= options.Cutoff {
+		samplingLengths = int(length / options.Cutoff)
+	}
+	sum := 0.0
+	for s := range samplingLengths {
+		values := []float64{}
+		for i, pos := range positions {
+			if samplingLengths == 1 || (pos >= start+float64(s)*options.Cutoff && pos < start+float64(s+1)*options.Cutoff) {
+				values = append(values, r[i])
+			}
+		}
+		sum += peakToValley(values)
+	}
+	params.Rz = sum / float64(samplingLengths)
+
+	return params, nil
+}
+
+// Area computes the areal parameters and the flatness of the cells within the
+// region. Cells filled by FillHoles are left out. The S parameters use the surface after removing the least squares
+// plane and the gaussian filter, the flatness uses the unfiltered surface.
+func Area(hm *heightmap.HeightMap, region measure.Region, options Options) (AreaParameters, error) {
+	if err := options.Validate(); err != nil {
+		return AreaParameters{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	frames := []int{}
+	for frame := range hm.Frames() {
+		if x := hm.FrameToMM(frame); x >= region.MinX && x <= region.MaxX {
+			frames = append(frames, frame)
+		}
+	}
+	rows := []int{}
+	for row := range hm.Rows() {
+		if y := hm.RowToMM(row); y >= region.MinY && y <= region.MaxY {
+			rows = append(rows, row)
+		}
+	}
+
+	points := [][3]float64{}
+	for _, frame := range frames {
+		for _, row := range rows {
+			if hm.Measured(frame, row) {
+				points = append(points, [3]float64{hm.FrameToMM(frame), hm.RowToMM(row), hm.At(frame, row)})
+			}
+		}
+	}
+	if len(points) < 3 {
+		return AreaParameters{}, fmt.Errorf("need at least 3 valid cells in region \"%s\" but found %d", region.Name, len(points))
+	}
+	plane, err := heightmap.FitPlane(points)
+	if err != nil {
+		return AreaParameters{}, fmt.Errorf("failed to remove form: %w", err)
+	}
+
+	// residual surface on the grid of the region, NaN where nothing was measured
+	grid := make([][]float64, len(frames))
+	for i, frame := range frames {
+		grid[i] = make([]float64, len(rows))
+		for j, row := range rows {
+			grid[i][j] = math.NaN()
+			if hm.Measured(frame, row) {
+				grid[i][j] = hm.At(frame, row) - plane.At(hm.FrameToMM(frame), hm.RowToMM(row))
+			}
+		}
+	}
+
+	params := AreaParameters{Name: region.Name, Cells: len(points)}
+	residuals := []float64{}
+	for i := range grid {
+		for _, v := range grid[i] {
+			if !math.IsNaN(v) {
+				residuals = append(residuals, v)
+			}
+		}
+	}
+	params.FlatnessLeastSquares = peakToValley(residuals)
+	params.FlatnessMinimumZone = minimumZone(points, plane, params.FlatnessLeastSquares)
+
+	if options.Cutoff > 0 {
+		grid = gaussianGrid(hm, frames, rows, grid, options.Cutoff)
+		residuals = residuals[:0]
+		for i := range grid {
+			for _, v := range grid[i] {
+				if !math.IsNaN(v) {
+					residuals = append(residuals, v)
+				}
+			}
+		}
+	}
+	for _, v := range residuals {
+		params.Sa += math.Abs(v)
+		params.Sq += v * v
+	}
+	params.Sa /= float64(len(residuals))
+	params.Sq = math.Sqrt(params.Sq / float64(len(residuals)))
+	params.Sz = peakToValley(residuals)
+
+	return params, nil
+}
+
+// minimumZone returns the smallest distance between two parallel planes that
+// enclose all points. The zone is convex in the tilt of the planes, so it is
+// searched by nested golden section searches around the least squares plane.
+func minimumZone(points [][3]float64, ls heightmap.Plane, lsFlatness float64) float64 {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+
+	zone := func(a float64, b float64) float64 {
+		lowest, highest := math.Inf(1), math.Inf(-1)
+		for _, p := range points {
+			r := p[2] - a*p[0] - b*p[1]
+			lowest, highest = math.Min(lowest, r), math.Max(highest, r)
+		}
+		return highest - lowest
+	}
+	// a plane that is tilted by more than twice the least squares flatness over
+	// the extent of the area can not enclose the points more tightly
+	searchB := func(a float64) float64 {
+		if maxY <= minY {
+			return zone(a, ls.B)
+		}
+		d := 2 * lsFlatness / (maxY - minY)
+		return goldenSection(ls.B-d, ls.B+d, func(b float64) float64 { return zone(a, b) })
+	}
+	if maxX <= minX {
+		return searchB(ls.A)
+	}
+	d := 2 * lsFlatness / (maxX - minX)
+	mz := goldenSection(ls.A-d, ls.A+d, searchB)
+
+	// the search only approximates the minimum, so it is never worse than least squares
+	return math.Min(mz, lsFlatness)
+}
+
+// returns the minimum of a convex function between lo and hi
+func goldenSection(lo float64, hi float64, f func(float64) float64) float64 {
+	const iterations = 40
+	ratio := (math.Sqrt(5) - 1) / 2
+
+	x1 := hi - ratio*(hi-lo)
+	x2 := lo + ratio*(hi-lo)
+	f1, f2 := f(x1), f(x2)
+	for range iterations {
+		if f1 < f2 {
+			hi, x2, f2 = x2, x1, f1
+			x1 = hi - ratio*(hi-lo)
+			f1 = f(x1)
+		} else {
+			lo, x1, f1 = x1, x2, f2
+			x2 = lo + ratio*(hi-lo)
+			f2 = f(x2)
+		}
+	}
+
+	return math.Min(f1, f2)
+}
+
+// gaussian returns the mean line of the values by applying the gaussian filter
+// of ISO 16610-21. The weights are normalized over the samples within λc, so
+// the filter also works at the ends of the profile, with missing samples and
+// with samples that are not evenly spaced. NaN values are skipped.
+func gaussian(positions []float64, values []float64, cutoff float64) []float64 {
+	result := make([]float64, len(values))
+	for i, center := range positions {
+		if math.IsNaN(values[i]) {
+			result[i] = math.NaN()
+			continue
+		}
+		sum, weights := 0.0, 0.0
+		for j, pos := range positions {
+			d := pos - center
+			if math.IsNaN(values[j]) || math.Abs(d) > cutoff {
+				continue
+			}
+			w := math.Exp(-math.Pi * math.Pow(d/(gaussianAlpha*cutoff), 2))
+			sum += w * values[j]
+			weights += w
+		}
+		result[i] = sum / weights
+	}
+
+	return result
+}
+
+// removes the waviness from the grid by applying the gaussian filter along
+// the rows and then along the frames, which equals the areal gaussian filter
+func gaussianGrid(hm *heightmap.HeightMap, frames []int, rows []int, grid [][]float64, cutoff float64) [][]float64 {
+	rowPositions := make([]float64, len(rows))
+	for j, row := range rows {
+		rowPositions[j] = hm.RowToMM(row)
+	}
+	framePositions := make([]float64, len(frames))
+	for i, frame := range frames {
+		framePositions[i] = hm.FrameToMM(frame)
+	}
+
+	waviness := make([][]float64, len(grid))
+	for i := range grid {
+		waviness[i] = gaussian(rowPositions, grid[i], cutoff)
+	}
+	column := make([]float64, len(frames))
+	for j := range rows {
+		for i := range frames {
+			column[i] = waviness[i][j]
+		}
+		filtered := gaussian(framePositions, column, cutoff)
+		for i := range frames {
+			waviness[i][j] = filtered[i]
+		}
+	}
+
+	result := make([][]float64, len(grid))
+	for i := range grid {
+		result[i] = make([]float64, len(grid[i]))
+		for j, v := range grid[i] {
+			result[i][j] = v - waviness[i][j]
+		}
+	}
+
+	return result
+}
+
+func peakToValley(values []float64) float64 {
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		lowest, highest = math.Min(lowest, v), math.Max(highest, v)
+	}
+	if len(values) == 0 {
+		return 0
+	}
+
+	return highest - lowest
+}
+
+// FrameParameters are the roughness parameters of the profile of one frame.
+// Error is set instead if the profile could not be evaluated.
+type FrameParameters struct {
+	Frame    int     `json:"frame"`
+	Position float64 `json:"position"`
+	ProfileParameters
+	Error string `json:"error,omitempty"`
+}
+
+// Report holds the roughness of the profiles and the areal parameters and
+// flatness of the areas. All values are in mm.
+type Report struct {
+	Units    string            `json:"units"`
+	Cutoff   float64           `json:"cutoff"`
+	Profiles []FrameParameters `json:"profiles,omitempty"`
+	Areas    []AreaParameters  `json:"areas,omitempty"`
+}
+
+// NewReport evaluates the profiles of the given frames and the regions. If no
+// region is given the whole height map is evaluated as one area.
+func NewReport(hm *heightmap.HeightMap, frames []int, regions []measure.Region, options Options) (Report, error) {
+	if err := options.Validate(); err != nil {
+		return Report{}, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	report := Report{Units: "mm", Cutoff: options.Cutoff}
+	for _, frame := range frames {
+		fp := FrameParameters{Frame: frame, Position: hm.FrameToMM(frame)}
+		params, err := Profile(section.FromHeightMap(hm, frame), options)
+		if err != nil {
+			fp.Error = err.Error()
+		}
+		fp.ProfileParameters = params
+		report.Profiles = append(report.Profiles, fp)
+	}
+
+	if len(regions) == 0 {
+		minX, minY, maxX, maxY := hm.Bounds()
+		regions = []measure.Region{{Name: "total", MinX: minX, MinY: minY, MaxX: maxX, MaxY: maxY}}
+	}
+	for _, region := range regions {
+		params, err := Area(hm, region, options)
+		if err != nil {
+			return Report{}, err
+		}
+		report.Areas = append(report.Areas, params)
+	}
+
+	return report, nil
+}
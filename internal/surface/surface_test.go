@@ -0,0 +1,119 @@
+package surface
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Neokil/ltp/internal/heightmap"
+	"github.com/Neokil/ltp/internal/measure"
+	"github.com/Neokil/ltp/internal/section"
+)
+
+func TestProfile(t *testing.T) {
+	// roughness with a wavelength of 0.1mm and an amplitude of 0.01mm on a tilted line
+	roughness := func(pos float64) float64 { return 0.01 * math.Cos(2*math.Pi*pos/0.1) }
+	waviness := func(pos float64) float64 { return 0.1 * math.Sin(2*math.Pi*pos/16) }
+
+	tests := []struct {
+		name      string
+		height    func(pos float64) float64
+		cutoff    float64
+		tolerance float64 // relative to the expected value
+	}{
+		{name: "without filter", height: roughness, cutoff: 0, tolerance: 0.01},
+		{name: "waviness is filtered", height: func(pos float64) float64 { return roughness(pos) + waviness(pos) }, cutoff: 0.8, tolerance: 0.03},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := section.Profile{}
+			for i := 0; i <= 1600; i++ {
+				pos := float64(i) * 0.005
+				p.Position = append(p.Position, pos)
+				p.Height = append(p.Height, tt.height(pos)+0.1*pos)
+			}
+
+			options := NewOptions()
+			options.Cutoff = tt.cutoff
+			got, err := Profile(p, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ProfileParameters{Ra: 0.02 / math.Pi, Rq: 0.01 / math.Sqrt2, Rz: 0.02, Rt: 0.02}
+			for _, c := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"Ra", got.Ra, want.Ra},
+				{"Rq", got.Rq, want.Rq},
+				{"Rz", got.Rz, want.Rz},
+				{"Rt", got.Rt, want.Rt},
+			} {
+				if math.Abs(c.got-c.want) > tt.tolerance*c.want {
+					t.Errorf("%s = %f, want %f", c.name, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestProfileGap(t *testing.T) {
+	// long enough for the filter, but all samples are within λc/2 of the ends
+	p := section.Profile{
+		Position: []float64{0, 0.01, 0.02, 5, 5.01, 5.02},
+		Height:   []float64{0, 0.01, 0, 0, 0.01, 0},
+	}
+	if _, err := Profile(p, NewOptions()); err == nil {
+		t.Errorf("Profile() without samples to evaluate should fail")
+	}
+}
+
+func TestArea(t *testing.T) {
+	options := heightmap.NewOptions()
+	options.Rows = 10
+	hm, err := heightmap.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a tilted plane with one bump of 1mm
+	for frame := range 10 {
+		heights := make([]float64, 10)
+		for row := range heights {
+			heights[row] = 0.1*float64(frame) + 0.05*float64(row)
+		}
+		if frame == 2 {
+			heights[3] += 1
+		}
+		if err := hm.AddHeightsAt(heights, float64(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	so := NewOptions()
+	so.Cutoff = 0
+	got, err := Area(hm, measure.Region{Name: "plate", MinX: 0, MinY: 0, MaxX: 9, MaxY: 9}, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got.FlatnessMinimumZone-1) > 1e-6 {
+		t.Errorf("FlatnessMinimumZone = %f, want 1", got.FlatnessMinimumZone)
+	}
+	if got.FlatnessLeastSquares < got.FlatnessMinimumZone {
+		t.Errorf("FlatnessLeastSquares = %f is smaller than the minimum zone", got.FlatnessLeastSquares)
+	}
+	if math.Abs(got.Sz-got.FlatnessLeastSquares) > 1e-9 || got.Cells != 100 {
+		t.Errorf("Sz = %f with %d cells, want %f with 100 cells", got.Sz, got.Cells, got.FlatnessLeastSquares)
+	}
+
+	// a filled hole next to the bump is not part of the surface
+	hm.Heights[3][3] = math.NaN()
+	if filled := hm.FillHoles(1); filled != 1 {
+		t.Fatalf("FillHoles() = %d, want 1", filled)
+	}
+	filled, err := Area(hm, measure.Region{Name: "plate", MinX: 0, MinY: 0, MaxX: 9, MaxY: 9}, so)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filled.Cells != 99 || math.Abs(filled.FlatnessMinimumZone-1) > 1e-6 {
+		t.Errorf("Area() with a filled hole = %d cells and minimum zone %f, want 99 cells and 1", filled.Cells, filled.FlatnessMinimumZone)
+	}
+}
@@ -2,6 +2,7 @@ package videoreader
 
 import (
 	"fmt"
+	"image"
 
 	vidio "github.com/AlexEidt/Vidio"
 )
@@ -14,10 +15,14 @@ type VideoReader interface {
 
 type VideoHandle interface {
 	GetNextFrame() ([]byte, error)
+	GetNextImage() (image.Image, error)
+	FPS() float64
+	FrameIndex() int // index of the frame last returned by GetNextFrame, -1 before the first frame
 }
 
 type videoReader struct {
-	v *vidio.Video
+	v          *vidio.Video
+	frameIndex int
 }
 
 func New() VideoReader {
@@ -30,14 +35,37 @@ func (vr *videoReader) Read(filename string) (VideoHandle, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read video from file: %w", err)
 	}
+	vr.frameIndex = -1
 
 	return vr, nil
 }
 
 func (vr *videoReader) GetNextFrame() ([]byte, error) {
 	if vr.v.Read() {
+		vr.frameIndex++
 		return vr.v.FrameBuffer(), nil
 	}
 
 	return nil, EOF
 }
+
+func (vr *videoReader) FPS() float64 {
+	return vr.v.FPS()
+}
+
+func (vr *videoReader) FrameIndex() int {
+	return vr.frameIndex
+}
+
+// GetNextImage reads the next frame and wraps the raw RGBA frame buffer into an image.
+func (vr *videoReader) GetNextImage() (image.Image, error) {
+	frame, err := vr.GetNextFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, vr.v.Width(), vr.v.Height()))
+	copy(img.Pix, frame)
+
+	return img, nil
+}